@@ -3,20 +3,58 @@ package main
 import (
 	"OnlieStore/internal/api"
 	"OnlieStore/internal/app"
+	"OnlieStore/internal/config"
+	"errors"
+	"flag"
 	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
-	newApp := app.NewApp() // new app
+	// --config and the flags of the settings, see config.Load
+	_, err := config.Init(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	newApp, err := app.NewApp() // new app
+	if err != nil {
+		panic(err)
+	}
+	defer newApp.Close()
 
 	e := echo.New()
 	newApi := api.NewApi(newApp, e) // new api
 
-	err := newApp.LoadData()
+	err = newApp.LoadData()
 	if err != nil {
 		panic(err)
 	}
 
+	go reloadOnHangup(newApp)
+
 	newApi.RegisterFunctions()
 	newApi.StartService()
 }
+
+// reloadOnHangup reloads the config on SIGHUP. An invalid config is logged and the current one is kept
+func reloadOnHangup(a *app.App) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	for range hangups {
+		cfg, err := config.Reload()
+		if err != nil {
+			logrus.WithError(err).Error("Failed to reload the config, keeping the current one")
+			continue
+		}
+
+		a.Reconfigure(cfg)
+		logrus.WithField("log_level", cfg.LogLevel).Info("Reloaded the config")
+	}
+}
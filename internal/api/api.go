@@ -3,9 +3,15 @@ package api
 import (
 	"OnlieStore/internal/api/request"
 	"OnlieStore/internal/app"
+	"OnlieStore/internal/auth"
 	"OnlieStore/internal/config"
+	"OnlieStore/internal/data"
 	"OnlieStore/internal/model"
+	"OnlieStore/internal/money"
+	"OnlieStore/internal/pagination"
+	"OnlieStore/internal/service"
 	"OnlieStore/internal/util"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -14,22 +20,69 @@ import (
 	"github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
+	"math"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageLimit = 10
+	maxPageLimit     = 100
+	maxImportBytes   = 10 << 20
 )
 
 type Api struct {
 	app       *app.App
 	echo      *echo.Echo
 	validator *validator.Validate
+	cursors   *pagination.Codec
 }
 
 func NewApi(app *app.App, e *echo.Echo) *Api {
+	e.IPExtractor = newIPExtractor(config.GetConfig().TrustedProxies)
 	return &Api{
 		app:       app,
 		echo:      e,
-		validator: validator.New(),
+		validator: newValidator(),
+		cursors:   pagination.NewCodec(config.GetConfig().Secret),
+	}
+}
+
+// newValidator checks the request fields, the password tag limits a password to the bytes bcrypt can hash
+func newValidator() *validator.Validate {
+	v := validator.New()
+	_ = v.RegisterValidation("password", func(fl validator.FieldLevel) bool {
+		return auth.IsValidPasswordLength(fl.Field().String())
+	})
+
+	return v
+}
+
+// newIPExtractor takes the client ip from the X-Forwarded-For header only for the requests of the trusted proxies,
+// without any the remote address is used, so that the clients can not choose the ip the logins are limited by
+func newIPExtractor(trustedProxies []string) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
 	}
+
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range trustedProxies {
+		_, ipRange, err := net.ParseCIDR(proxy)
+		if err != nil {
+			// the config validates the ranges
+			logrus.WithField("proxy", proxy).Warn("Ignoring the invalid trusted proxy")
+			continue
+		}
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+
+	return echo.ExtractIPFromXFFHeader(options...)
 }
 
 func (api *Api) StartService() {
@@ -44,50 +97,99 @@ func (api *Api) StopService(ctx context.Context) {
 
 func (api *Api) RegisterFunctions() {
 	logrus.Info("Registering the functions")
+	api.echo.Use(api.app.Metrics().Middleware())
+
+	// metrics
+	api.echo.GET("/metrics", echo.WrapHandler(api.app.Metrics().Handler()))
+
 	// login
 	api.echo.POST("/login", api.Login)
+	api.echo.POST("/register", api.Register)
+	api.echo.POST("/token/refresh", api.RefreshToken)
+	api.echo.GET("/.well-known/jwks.json", api.GetJWKS)
 
 	r := api.echo.Group("/api/v1")
 	r.Use(echojwt.WithConfig(echojwt.Config{
-		SigningKey: []byte(config.GetConfig().Secret),
+		ParseTokenFunc: func(c echo.Context, auth string) (interface{}, error) {
+			return api.app.ParseJWTToken(auth)
+		},
 	}))
 
+	r.POST("/logout", api.Logout)
+
 	// products
 	r.GET("/products", api.GetProducts)
-	r.POST("/products", api.AddProduct)
+	r.POST("/products", api.AddProduct, requireRoles(util.RoleAdmin, util.RoleStaff))
+	r.GET("/products/search", api.SearchProducts)
+	r.GET("/products/:id", api.GetProduct)
+	r.PUT("/products/:id", api.UpdateProduct, requireRoles(util.RoleAdmin, util.RoleStaff))
+	r.PATCH("/products/:id", api.UpdateProduct, requireRoles(util.RoleAdmin, util.RoleStaff))
+	r.DELETE("/products/:id", api.DeleteProduct, requireRoles(util.RoleAdmin, util.RoleStaff))
+	r.POST("/products/:id/stock", api.RestockProduct, requireRoles(util.RoleAdmin, util.RoleStaff))
+
+	// bulk catalog updates
+	r.POST("/admin/products/import", api.ImportProducts, requireRoles(util.RoleAdmin, util.RoleStaff))
+	r.GET("/admin/products/export", api.ExportProducts, requireRoles(util.RoleAdmin, util.RoleStaff))
+
+	// categories
+	r.GET("/categories", api.GetCategories)
+	r.POST("/categories", api.AddCategory, requireRoles(util.RoleAdmin, util.RoleStaff))
 
 	// orders
-	r.GET("/orders", api.GetOrder)
+	r.GET("/orders", api.GetOrders)
+	r.GET("/orders/:id", api.GetOrder)
 	r.POST("/order", api.AddNewOrder)
-	r.POST("/status", api.UpdateOrderStatus)
+	r.POST("/status", api.UpdateOrderStatus) // customers can cancel their own orders, see UpdateOrderStatus
+
+	// profile
+	r.GET("/me", api.GetProfile)
+	r.PATCH("/me", api.UpdateProfile)
+	r.POST("/me/password", api.ChangePassword)
+
+	// cart
+	r.GET("/cart", api.GetCart)
+	r.POST("/cart/items", api.AddCartItem)
+	r.PUT("/cart/items/:product_id", api.UpdateCartItem)
+	r.DELETE("/cart/items/:product_id", api.RemoveCartItem)
+	r.POST("/cart/checkout", api.Checkout)
 
 }
 
 func (api *Api) GetProducts(c echo.Context) error {
-	limit := c.QueryParam("limit")
-	page := c.QueryParam("page")
-
 	logrus.WithFields(logrus.Fields{"path": c.Request().URL.Path, "params": c.QueryParams()}).
 		Info("Incoming get products request")
 
 	// validate the request first
-	limitInt, pageInt, err := validateGetProductsRequest(limit, page)
+	filter, err := validateProductFilter(c.QueryParams())
+	if err != nil {
+		logrus.WithError(err).Error("Validation failed for GetProducts request")
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	scope := "products|" + filter.Key()
+	params, err := api.validatePaginationRequest(c, scope)
 	if err != nil {
 		logrus.WithError(err).Error("Validation failed for GetProducts request")
 		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
 	}
 
 	// process the request
-	result, err := api.app.GetProducts(&model.PaginationParams{
-		Limit: limitInt,
-		Page:  pageInt,
-	},
-	)
+	result, err := api.app.GetProducts(params, filter)
+	if errors.Is(err, service.ErrCategoryNotFound) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
 	if err != nil {
 		logrus.WithError(err).Error("Failed to process get products request")
 		return c.JSON(http.StatusInternalServerError, map[string]string{"Error": err.Error()})
 	}
 
+	if result.Next != nil {
+		result.NextCursor, err = api.cursors.Encode(result.Next, scope)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"Error": err.Error()})
+		}
+	}
+
 	logrus.Debug("Retrieved result ", result)
 	return c.JSON(http.StatusOK, result)
 }
@@ -107,28 +209,318 @@ func (api *Api) AddProduct(c echo.Context) error {
 	}
 
 	// process the request
-	api.app.AddProduct(product)
+	err = api.app.AddProduct(product)
+	if errors.Is(err, service.ErrSKUExists) {
+		return c.JSON(http.StatusConflict, map[string]string{"Error": err.Error()})
+	}
+	if errors.Is(err, service.ErrCategoryNotFound) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"Error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "success", "id": product.ID})
+}
+
+// SearchProducts is the full text search over the names and categories, best matches first
+func (api *Api) SearchProducts(c echo.Context) error {
+	query := strings.TrimSpace(c.QueryParam("q"))
+	if query == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": "Query is required "})
+	}
+
+	limit := defaultPageLimit
+	if limitStr := c.QueryParam("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"Error": fmt.Sprintf("Invalid limit : %s, should be a positive number", limitStr)})
+		}
+		limit = min(limit, maxPageLimit)
+	}
+
+	results, total := api.app.SearchProducts(query, limit)
+	return c.JSON(http.StatusOK, map[string]interface{}{"data": results, "total": total})
+}
+
+// GetProduct returns deleted products as well, with deleted_at set, so that past orders can be resolved
+func (api *Api) GetProduct(c echo.Context) error {
+	product, err := api.app.GetProduct(c.Param("id"))
+	if errors.Is(err, service.ErrProductNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"Error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"Error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, product)
+}
+
+// UpdateProduct replaces the name, price and category with PUT, PATCH changes only the fields given
+func (api *Api) UpdateProduct(c echo.Context) error {
+	req := new(request.ProductUpdate)
+	if err := c.Bind(req); err != nil {
+		logrus.WithError(err).Error("Failed to bind UpdateProduct request")
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	update, err := api.validateUpdateProductRequest(req, c.Request().Method == http.MethodPut)
+	if err != nil {
+		logrus.WithError(err).Error("Validation failed for UpdateProduct request")
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	product, err := api.app.UpdateProduct(c.Param("id"), update)
+	if errors.Is(err, service.ErrProductNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"Error": err.Error()})
+	}
+	if errors.Is(err, service.ErrCategoryNotFound) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"Error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, product)
+}
+
+// DeleteProduct removes the product from the catalog, it is kept for the orders which refer to it
+func (api *Api) DeleteProduct(c echo.Context) error {
+	err := api.app.DeleteProduct(c.Param("id"))
+	if errors.Is(err, service.ErrProductNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"Error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"Error": err.Error()})
+	}
+
 	return c.JSON(http.StatusOK, map[string]string{"message": "success"})
 }
 
-func (api *Api) GetOrder(c echo.Context) error {
-	orderId := c.QueryParam("order_id")
+func (api *Api) RestockProduct(c echo.Context) error {
+	req := new(request.Restock)
+	if err := c.Bind(req); err != nil {
+		logrus.WithError(err).Error("Failed to bind RestockProduct request")
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
 
-	if orderId == "" {
-		logrus.WithField("order_id", orderId).Error("Order Id is required")
-		err := errors.New("Order Id is required ")
+	err := api.validator.Struct(req)
+	if err != nil {
+		logrus.WithError(err).Error("Validation failed for RestockProduct request")
 		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
 	}
 
-	order, err := api.app.GetOrder(orderId)
+	product, err := api.app.RestockProduct(c.Param("id"), req.SKU, req.Quantity)
+	if errors.Is(err, service.ErrProductNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"Error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"Error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, product)
+}
+
+// ImportProducts adds and updates products from a CSV file or JSON lines, the format is given by the format
+// parameter or the content type. With dry_run=true the rows are only checked. When any row is refused nothing is
+// imported, and the report lists the refused rows with 422
+func (api *Api) ImportProducts(c echo.Context) error {
+	format, err := importFormat(c)
+	if err != nil {
+		logrus.WithError(err).Error("Validation failed for ImportProducts request")
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	dryRun := false
+	if value := c.QueryParam("dry_run"); value != "" {
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"Error": fmt.Sprintf("Invalid dry_run : %s, should be true or false", value)})
+		}
+	}
+
+	body := http.MaxBytesReader(c.Response(), c.Request().Body, maxImportBytes)
+	report, err := api.app.ImportProducts(body, format, dryRun)
+	if errors.Is(err, data.ErrInvalidImport) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"Error": err.Error()})
+	}
+
+	if len(report.Errors) > 0 {
+		return c.JSON(http.StatusUnprocessableEntity, report)
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// importFormat reads the format parameter, falling back to the content type of the body
+func importFormat(c echo.Context) (string, error) {
+	if format := c.QueryParam("format"); format != "" {
+		if !data.IsCatalogFormat(format) {
+			return "", errors.New(fmt.Sprintf("Invalid format : %s, should be csv or json", format))
+		}
+		return format, nil
+	}
+
+	contentType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	switch contentType {
+	case "text/csv":
+		return util.FormatCSV, nil
+	case "application/x-ndjson", "application/jsonl", echo.MIMEApplicationJSON:
+		return util.FormatJSON, nil
+	}
+
+	return "", errors.New(fmt.Sprintf("Unsupported content type : %s, give the format as csv or json", contentType))
+}
+
+// ExportProducts writes the catalog as a CSV file, or as JSON lines with format=json
+func (api *Api) ExportProducts(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = util.FormatCSV
+	}
+
+	if !data.IsCatalogFormat(format) {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"Error": fmt.Sprintf("Invalid format : %s, should be csv or json", format)})
+	}
+
+	var buf bytes.Buffer
+	err := api.app.ExportProducts(&buf, format)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"Error": err.Error()})
+	}
+
+	contentType, fileName := "text/csv", "products.csv"
+	if format == util.FormatJSON {
+		contentType, fileName = "application/x-ndjson", "products.jsonl"
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	return c.Blob(http.StatusOK, contentType, buf.Bytes())
+}
+
+// GetCategories returns the category tree, the product count of a category includes its sub categories
+func (api *Api) GetCategories(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{"data": api.app.GetCategories()})
+}
+
+func (api *Api) AddCategory(c echo.Context) error {
+	req := new(request.Category)
+	if err := c.Bind(req); err != nil {
+		logrus.WithError(err).Error("Failed to bind AddCategory request")
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	err := api.validator.Struct(req)
+	if err != nil {
+		logrus.WithError(err).Error("Validation failed for AddCategory request")
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	category, err := api.app.AddCategory(&model.CategoryDetails{
+		Slug:   strings.TrimSpace(req.Slug),
+		Name:   strings.TrimSpace(req.Name),
+		Parent: req.Parent,
+	})
+	if errors.Is(err, service.ErrCategoryExists) {
+		return c.JSON(http.StatusConflict, map[string]string{"Error": err.Error()})
+	}
+	if errors.Is(err, service.ErrCategoryNotFound) || errors.Is(err, service.ErrInvalidSlug) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"Error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, category)
+}
+
+// GetOrders lists the orders of the logged-in user, staff can list the orders of any user with user_id.
+// order_id is still accepted to get a single order
+func (api *Api) GetOrders(c echo.Context) error {
+	if orderId := c.QueryParam("order_id"); orderId != "" {
+		return api.writeOrder(c, orderId)
+	}
+
+	logrus.WithFields(logrus.Fields{"path": c.Request().URL.Path, "params": c.QueryParams()}).
+		Info("Incoming get orders request")
+
+	filter, err := validateOrderFilter(c.QueryParam("status"), c.QueryParam("from"), c.QueryParam("to"))
+	if err != nil {
+		logrus.WithError(err).Error("Validation failed for GetOrders request")
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	userID := getUserID(c)
+	if requested := c.QueryParam("user_id"); requested != "" && requested != userID {
+		if !isStaff(c) {
+			return c.JSON(http.StatusForbidden, map[string]string{"Error": "Permission denied"})
+		}
+		userID = requested
+	}
+
+	// cursors are bound to the user as well, a cursor of one user can not page through the orders of another
+	scope := "orders|" + userID + "|" + filter.Key()
+	params, err := api.validatePaginationRequest(c, scope)
+	if err != nil {
+		logrus.WithError(err).Error("Validation failed for GetOrders request")
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	orders, err := api.app.GetOrdersByUserID(userID, params, filter)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	if orders.Next != nil {
+		orders.NextCursor, err = api.cursors.Encode(orders.Next, scope)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"Error": err.Error()})
+		}
+	}
+
+	return c.JSON(http.StatusOK, orders)
+}
+
+func (api *Api) GetOrder(c echo.Context) error {
+	return api.writeOrder(c, c.Param("id"))
+}
+
+func (api *Api) writeOrder(c echo.Context, orderId string) error {
+	order, err := api.getAccessibleOrder(c, orderId)
+	if errors.Is(err, service.ErrOrderNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"Error": err.Error()})
+	}
 	if err != nil {
-		logrus.WithError(err).Error("Failed to get order")
 		return c.JSON(http.StatusInternalServerError, map[string]string{"Error": err.Error()})
 	}
 
 	return c.JSON(http.StatusOK, order)
 }
 
+// getAccessibleOrder returns the order when the logged-in user owns it or is staff. Orders of other users are
+// reported as not found, so that their ids can not be probed
+func (api *Api) getAccessibleOrder(c echo.Context, orderId string) (*model.Order, error) {
+	order, err := api.app.GetOrder(orderId)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.UserID != getUserID(c) && !isStaff(c) {
+		logrus.WithFields(logrus.Fields{"order_id": orderId, "user_id": getUserID(c)}).
+			Error("Order is owned by another user")
+		return nil, fmt.Errorf("%w, id: %s", service.ErrOrderNotFound, orderId)
+	}
+
+	return order, nil
+}
+
 func (api *Api) AddNewOrder(c echo.Context) error {
 	var req request.Order
 	if err := c.Bind(&req); err != nil {
@@ -136,9 +528,7 @@ func (api *Api) AddNewOrder(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
 	}
 
-	user := c.Get("user").(*jwt.Token)
-	claims := user.Claims.(jwt.MapClaims)
-	req.UserID = claims["user_id"].(string)
+	req.UserID = getUserID(c)
 
 	order, err := api.validateAndGetOrder(&req)
 	if err != nil {
@@ -147,34 +537,150 @@ func (api *Api) AddNewOrder(c echo.Context) error {
 	}
 
 	err = api.app.AddOrder(order)
+	if errors.Is(err, service.ErrInsufficientStock) || errors.Is(err, service.ErrPriceMismatch) {
+		logrus.WithError(err).Error("Failed to add order")
+		return c.JSON(http.StatusConflict, map[string]string{"Error": err.Error()})
+	}
+	if errors.Is(err, money.ErrOverflow) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
 	if err != nil {
 		logrus.WithError(err).Error("Failed to add order")
 		return c.JSON(http.StatusInternalServerError, map[string]string{"Error": err.Error()})
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{"message": "success"})
+	// the order carries its id and the prices taken from the catalog
+	return c.JSON(http.StatusCreated, order)
+}
+
+func (api *Api) GetCart(c echo.Context) error {
+	return c.JSON(http.StatusOK, api.app.GetCart(getUserID(c)))
+}
+
+func (api *Api) AddCartItem(c echo.Context) error {
+	req := new(request.CartItem)
+	if err := c.Bind(req); err != nil {
+		logrus.WithError(err).Error("Failed to bind AddCartItem request")
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	err := api.validator.Struct(req)
+	if err != nil {
+		logrus.WithError(err).Error("Validation failed for AddCartItem request")
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	cart, err := api.app.AddCartItem(getUserID(c), req.ProductID, req.SKU, req.Quantity)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, cart)
+}
+
+func (api *Api) UpdateCartItem(c echo.Context) error {
+	req := new(request.CartItemUpdate)
+	if err := c.Bind(req); err != nil {
+		logrus.WithError(err).Error("Failed to bind UpdateCartItem request")
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	err := api.validator.Struct(req)
+	if err != nil {
+		logrus.WithError(err).Error("Validation failed for UpdateCartItem request")
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	cart, err := api.app.UpdateCartItem(getUserID(c), c.Param("product_id"), c.QueryParam("sku"), req.Quantity)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"Error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, cart)
 }
 
-func validateGetProductsRequest(limitStr string, pageStr string) (int, int, error) {
-	limit := 10
-	page := 1
+func (api *Api) RemoveCartItem(c echo.Context) error {
+	cart, err := api.app.RemoveCartItem(getUserID(c), c.Param("product_id"), c.QueryParam("sku"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"Error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, cart)
+}
+
+func (api *Api) Checkout(c echo.Context) error {
+	order, err := api.app.Checkout(getUserID(c))
+	if errors.Is(err, service.ErrInsufficientStock) {
+		return c.JSON(http.StatusConflict, map[string]string{"Error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, order)
+}
+
+// validatePaginationRequest reads limit with either cursor or page. The cursor should have been made for the
+// same scope, i.e. the same listing and filter. Limits above maxPageLimit are capped
+func (api *Api) validatePaginationRequest(c echo.Context, scope string) (*model.PaginationParams, error) {
+	params := &model.PaginationParams{Limit: defaultPageLimit, Page: 1}
 	var err error
 
-	if limitStr != "" {
-		limit, err = strconv.Atoi(limitStr)
+	if limitStr := c.QueryParam("limit"); limitStr != "" {
+		params.Limit, err = strconv.Atoi(limitStr)
+		if err != nil || params.Limit <= 0 {
+			return nil, errors.New(fmt.Sprintf("Invalid limit : %s, should be a positive number", limitStr))
+		}
+		params.Limit = min(params.Limit, maxPageLimit)
+	}
+
+	cursor, pageStr := c.QueryParam("cursor"), c.QueryParam("page")
+	if cursor != "" && pageStr != "" {
+		return nil, errors.New("Only one of cursor and page can be given ")
+	}
+
+	if cursor != "" {
+		params.Cursor, err = api.cursors.Decode(cursor, scope)
 		if err != nil {
-			return 0, 0, err
+			return nil, err
 		}
 	}
 
 	if pageStr != "" {
-		page, err = strconv.Atoi(pageStr)
+		params.Page, err = strconv.Atoi(pageStr)
+		if err != nil || params.Page <= 0 {
+			return nil, errors.New(fmt.Sprintf("Invalid page : %s, should be a positive number", pageStr))
+		}
+	}
+
+	return params, nil
+}
+
+func (api *Api) validateUpdateProductRequest(input *request.ProductUpdate,
+	replace bool) (*model.ProductUpdate, error) {
+	err := api.validator.Struct(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if replace && (input.Name == nil || input.Price == nil || input.Category == nil) {
+		return nil, errors.New("Name, price and category are required ")
+	}
+
+	update := &model.ProductUpdate{Name: input.Name, Category: input.Category}
+	if input.Price != nil {
+		price, err := money.Parse(*input.Price, config.GetConfig().Currency)
 		if err != nil {
-			return 0, 0, err
+			return nil, err
 		}
+
+		if !price.IsPositive() {
+			return nil, errors.New("Price should be greater than zero ")
+		}
+		update.Price = &price
 	}
 
-	return limit, page, err
+	return update, nil
 }
 
 func (api *Api) validateAddProductRequest(input *request.ProductDetails) (*model.ProductDetails, error) {
@@ -183,17 +689,40 @@ func (api *Api) validateAddProductRequest(input *request.ProductDetails) (*model
 		return nil, err
 	}
 
-	price, err := strconv.ParseFloat(input.Price, 64)
+	price, err := money.Parse(input.Price, config.GetConfig().Currency)
 	if err != nil {
-		return nil, errors.New("Invalid price ")
+		return nil, err
 	}
 
-	return &model.ProductDetails{
+	if !price.IsPositive() {
+		return nil, errors.New("Price should be greater than zero ")
+	}
+
+	product := &model.ProductDetails{
 		Name:          input.Name,
 		Price:         price,
 		Category:      input.Category,
 		AddedQuantity: input.AddedQuantity,
-	}, nil
+	}
+
+	for _, v := range input.Variants {
+		variant := &model.VariantDetails{SKU: v.SKU, Attributes: v.Attributes, AddedQuantity: v.AddedQuantity}
+		if v.Price != "" {
+			variantPrice, err := money.Parse(v.Price, config.GetConfig().Currency)
+			if err != nil {
+				return nil, err
+			}
+
+			if !variantPrice.IsPositive() {
+				return nil, errors.New(fmt.Sprintf("Price of variant %s should be greater than zero", v.SKU))
+			}
+			variant.Price = &variantPrice
+		}
+
+		product.Variants = append(product.Variants, variant)
+	}
+
+	return product, nil
 }
 
 func (api *Api) Login(c echo.Context) error {
@@ -207,15 +736,164 @@ func (api *Api) Login(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
 	}
 
-	token, err := api.app.GenerateJWTToken(req.Username, req.Password)
+	tokens, wait, err := api.app.GenerateJWTToken(req.Username, req.Password, c.RealIP())
+	if errors.Is(err, auth.ErrLoginThrottled) {
+		// rounded up, so that a client waiting for Retry-After is not throttled again
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"Error": err.Error()})
+	}
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"Error": service.ErrInvalidCredentials.Error()})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"Error": err.Error()})
 	}
 
-	return c.JSON(http.StatusOK, &request.LoginResponse{
-		Status: "success",
-		Token:  token,
-	})
+	return c.JSON(http.StatusOK, newLoginResponse(tokens))
+}
+
+func (api *Api) RefreshToken(c echo.Context) error {
+	req := new(request.RefreshToken)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	err := api.validator.Struct(req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	tokens, err := api.app.RefreshJWTToken(req.RefreshToken)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"Error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, newLoginResponse(tokens))
+}
+
+func (api *Api) Logout(c echo.Context) error {
+	api.app.Logout(c.Get("user").(*jwt.Token))
+	return c.JSON(http.StatusOK, map[string]string{"message": "success"})
+}
+
+// GetJWKS publishes the public keys, so that other services can verify the access tokens
+func (api *Api) GetJWKS(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, api.app.GetJWKS())
+}
+
+func newLoginResponse(tokens *auth.TokenPair) *request.LoginResponse {
+	return &request.LoginResponse{
+		Status:       "success",
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int(tokens.ExpiresIn.Seconds()),
+	}
+}
+
+func (api *Api) Register(c echo.Context) error {
+	req := new(request.RegisterUser)
+	if err := c.Bind(req); err != nil {
+		logrus.WithError(err).Error("Failed to bind Register request")
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	err := api.validator.Struct(req)
+	if err != nil {
+		logrus.WithError(err).Error("Validation failed for Register request")
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	user := &model.User{
+		Name:        req.Username,
+		Role:        util.RoleCustomer,
+		Email:       req.Email,
+		DisplayName: req.DisplayName,
+		Addresses:   []*model.Address{},
+	}
+
+	err = api.app.RegisterUser(user, req.Password)
+	if errors.Is(err, service.ErrUserExists) {
+		return c.JSON(http.StatusConflict, map[string]string{"Error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"Error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, user)
+}
+
+func (api *Api) GetProfile(c echo.Context) error {
+	user, err := api.app.GetUser(getUserID(c))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"Error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
+
+func (api *Api) UpdateProfile(c echo.Context) error {
+	req := new(request.ProfileUpdate)
+	if err := c.Bind(req); err != nil {
+		logrus.WithError(err).Error("Failed to bind UpdateProfile request")
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	err := api.validator.Struct(req)
+	if err != nil {
+		logrus.WithError(err).Error("Validation failed for UpdateProfile request")
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	update := &model.ProfileUpdate{
+		Email:       req.Email,
+		DisplayName: req.DisplayName,
+	}
+
+	if req.Addresses != nil {
+		update.Addresses = make([]*model.Address, 0, len(*req.Addresses))
+		for _, a := range *req.Addresses {
+			update.Addresses = append(update.Addresses, &model.Address{
+				Label:      a.Label,
+				Line1:      a.Line1,
+				Line2:      a.Line2,
+				City:       a.City,
+				PostalCode: a.PostalCode,
+				Country:    a.Country,
+			})
+		}
+	}
+
+	user, err := api.app.UpdateProfile(getUserID(c), update)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"Error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
+
+func (api *Api) ChangePassword(c echo.Context) error {
+	req := new(request.PasswordChange)
+	if err := c.Bind(req); err != nil {
+		logrus.WithError(err).Error("Failed to bind ChangePassword request")
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	err := api.validator.Struct(req)
+	if err != nil {
+		logrus.WithError(err).Error("Validation failed for ChangePassword request")
+		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
+	}
+
+	err = api.app.ChangePassword(getUserID(c), req.CurrentPassword, req.NewPassword)
+	if errors.Is(err, service.ErrWrongPassword) {
+		return c.JSON(http.StatusForbidden, map[string]string{"Error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"Error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "success"})
 }
 
 func (api *Api) isValidLoginRequest(input *request.UserLogin) error {
@@ -228,16 +906,23 @@ func (api *Api) validateAndGetOrder(input *request.Order) (*model.Order, error)
 		return nil, err
 	}
 
-	price, err := strconv.ParseFloat(input.Price, 64)
-	if err != nil {
-		return nil, errors.New("Invalid price ")
+	item := &model.OrderItem{
+		ProductID: input.ProductID,
+		SKU:       input.SKU,
+		Quantity:  input.Quantity,
+	}
+
+	if input.Price != "" {
+		price, err := money.Parse(input.Price, config.GetConfig().Currency)
+		if err != nil {
+			return nil, err
+		}
+		item.ExpectedPrice = &price
 	}
 
 	return &model.Order{
-		Quantity:  input.Quantity,
-		Price:     price,
-		ProductID: input.ProductID,
-		UserID:    input.UserID,
+		UserID: input.UserID,
+		Items:  []*model.OrderItem{item},
 	}, nil
 }
 
@@ -251,7 +936,28 @@ func (api *Api) UpdateOrderStatus(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"Error": err.Error()})
 	}
 
-	err = api.app.UpdateOrderStatus(orderId, orderDtl.Status)
+	// fulfilment is done by the staff, customers can only cancel their own orders
+	_, err = api.getAccessibleOrder(c, orderId)
+	if errors.Is(err, service.ErrOrderNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"Error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"Error": err.Error()})
+	}
+
+	if !isStaff(c) && orderDtl.Status != util.OrderStatusCancelled {
+		logrus.WithFields(logrus.Fields{"order_id": orderId, "user_id": getUserID(c)}).
+			Error("Permission denied to update the order status")
+		return c.JSON(http.StatusForbidden, map[string]string{"Error": "Permission denied"})
+	}
+
+	err = api.app.UpdateOrderStatus(orderId, orderDtl.Status, getUserID(c))
+	if errors.Is(err, service.ErrOrderNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"Error": err.Error()})
+	}
+	if errors.Is(err, model.ErrInvalidStatusTransition) {
+		return c.JSON(http.StatusConflict, map[string]string{"Error": err.Error()})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"Error": err.Error()})
 	}
@@ -259,6 +965,116 @@ func (api *Api) UpdateOrderStatus(c echo.Context) error {
 	return c.JSON(http.StatusOK, "success")
 }
 
+// validateOrderFilter reads the status and the creation date range, dates are RFC 3339 or YYYY-MM-DD
+func validateOrderFilter(status string, from string, to string) (*model.OrderFilter, error) {
+	filter := &model.OrderFilter{}
+	if status != "" {
+		valid := false
+		for _, s := range util.OrderStatuses {
+			if string(s) == status {
+				valid = true
+			}
+		}
+
+		if !valid {
+			return nil, errors.New(fmt.Sprintf("Invalid status : %s", status))
+		}
+		filter.Status = status
+	}
+
+	var err error
+	if from != "" {
+		filter.From, err = parseDate(from)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if to != "" {
+		filter.To, err = parseDate(to)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return nil, errors.New("Invalid date range, from should be before to ")
+	}
+
+	return filter, nil
+}
+
+// validateProductFilter reads category, min_price, max_price, in_stock, q and sort of a product listing
+func validateProductFilter(params url.Values) (*model.ProductFilter, error) {
+	filter := &model.ProductFilter{
+		Category: strings.TrimSpace(params.Get("category")),
+		Name:     strings.TrimSpace(params.Get("q")),
+		Sort:     params.Get("sort"),
+	}
+
+	if filter.Sort != "" && !slices.Contains(util.ProductSorts, filter.Sort) {
+		return nil, errors.New(fmt.Sprintf("Invalid sort : %s, should be one of %s", filter.Sort,
+			strings.Join(util.ProductSorts, ", ")))
+	}
+
+	if v := params.Get("in_stock"); v != "" {
+		inStock, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid in_stock : %s", v))
+		}
+		filter.InStock = inStock
+	}
+
+	var err error
+	filter.MinPrice, err = parsePriceParam("min_price", params.Get("min_price"))
+	if err != nil {
+		return nil, err
+	}
+
+	filter.MaxPrice, err = parsePriceParam("max_price", params.Get("max_price"))
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.MinPrice != nil && filter.MaxPrice != nil && filter.MinPrice.Amount > filter.MaxPrice.Amount {
+		return nil, errors.New("Invalid price range, min_price should not be greater than max_price ")
+	}
+
+	return filter, nil
+}
+
+// parsePriceParam returns nil when the parameter is not given
+func parsePriceParam(name string, value string) (*money.Money, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	price, err := money.Parse(value, config.GetConfig().Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	if price.Amount < 0 {
+		return nil, errors.New(fmt.Sprintf("Invalid %s : %s", name, value))
+	}
+
+	return &price, nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+
+	t, err = time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, errors.New(fmt.Sprintf("Invalid date : %s", value))
+	}
+
+	return t, nil
+}
+
 func validateUpdateOrderRequest(orderId string, status string) (*request.OrderDetail, error) {
 	if orderId == "" {
 		return nil, errors.New("Order Id is required ")
@@ -278,6 +1094,8 @@ func validateUpdateOrderRequest(orderId string, status string) (*request.OrderDe
 		orderStatus = util.OrderStatusShipped
 	case string(util.OrderStatusDelivered):
 		orderStatus = util.OrderStatusDelivered
+	case string(util.OrderStatusError):
+		orderStatus = util.OrderStatusError // the order failed, staff only
 	default:
 		return nil, errors.New("Failed to update order status as status is invalid ")
 	}
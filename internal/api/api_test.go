@@ -0,0 +1,185 @@
+package api
+
+import (
+	"OnlieStore/internal/api/request"
+	"OnlieStore/internal/app"
+	"OnlieStore/internal/config"
+	"OnlieStore/internal/model"
+	"OnlieStore/internal/util"
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	logrus.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestServer serves the api of an app with the default config and a single customer, charlie.dias
+func newTestServer(t *testing.T) *echo.Echo {
+	t.Helper()
+
+	a, err := app.NewApp()
+	if err != nil {
+		t.Fatalf("failed to create the app: %v", err)
+	}
+	t.Cleanup(func() { _ = a.Close() })
+
+	user := &model.User{Name: "charlie.dias", Role: util.RoleCustomer, Addresses: []*model.Address{}}
+	err = a.RegisterUser(user, "Test@123")
+	if err != nil {
+		t.Fatalf("failed to add the user: %v", err)
+	}
+
+	e := echo.New()
+	NewApi(a, e).RegisterFunctions()
+	return e
+}
+
+// serve sends the request to the server, the body is sent as JSON when given
+func serve(e *echo.Echo, method string, path string, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func login(t *testing.T, e *echo.Echo) *request.LoginResponse {
+	t.Helper()
+
+	rec := serve(e, http.MethodPost, "/login", `{"username":"charlie.dias","password":"Test@123"}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login = %d %s, want 200", rec.Code, rec.Body)
+	}
+
+	var res request.LoginResponse
+	err := json.Unmarshal(rec.Body.Bytes(), &res)
+	if err != nil {
+		t.Fatalf("failed to read the login response: %v", err)
+	}
+
+	return &res
+}
+
+func bearer(token string) http.Header {
+	return http.Header{echo.HeaderAuthorization: {"Bearer " + token}}
+}
+
+func TestLogout(t *testing.T) {
+	e := newTestServer(t)
+	tokens := login(t, e)
+
+	if rec := serve(e, http.MethodGet, "/api/v1/me", "", bearer(tokens.Token)); rec.Code != http.StatusOK {
+		t.Fatalf("profile before the logout = %d, want 200", rec.Code)
+	}
+
+	if rec := serve(e, http.MethodPost, "/api/v1/logout", "", bearer(tokens.Token)); rec.Code != http.StatusOK {
+		t.Fatalf("logout = %d, want 200", rec.Code)
+	}
+
+	if rec := serve(e, http.MethodGet, "/api/v1/me", "", bearer(tokens.Token)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("profile after the logout = %d, want 401", rec.Code)
+	}
+
+	body := `{"refresh_token":"` + tokens.RefreshToken + `"}`
+	if rec := serve(e, http.MethodPost, "/token/refresh", body, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("refresh after the logout = %d, want 401", rec.Code)
+	}
+}
+
+func TestPasswordValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{name: "ascii", password: "Test@123"},
+		{name: "72 bytes", password: strings.Repeat("a", 72)},
+		{name: "73 bytes", password: strings.Repeat("a", 73), wantErr: true},
+		{name: "24 characters of 3 bytes", password: strings.Repeat("€", 24)},
+		// fewer than 72 characters, but more than 72 bytes
+		{name: "25 characters of 3 bytes", password: strings.Repeat("€", 25), wantErr: true},
+		{name: "too short", password: "Te@1", wantErr: true},
+	}
+
+	v := newValidator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Struct(&request.RegisterUser{Username: "charlie", Password: tt.password})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RegisterUser error = %v, want an error: %v", err, tt.wantErr)
+			}
+
+			err = v.Struct(&request.PasswordChange{CurrentPassword: "Test@123", NewPassword: tt.password})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PasswordChange error = %v, want an error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoginThrottlesSpoofedIPs(t *testing.T) {
+	e := newTestServer(t)
+	limit := config.GetConfig().LoginMaxAttemptsPerIP
+
+	// every attempt claims another client ip and another username, so only the limit of the remote address applies
+	for i := 0; i < limit; i++ {
+		ip := fmt.Sprintf("203.0.113.%d", i%250+1)
+		header := http.Header{echo.HeaderXForwardedFor: {ip}, echo.HeaderXRealIP: {ip}}
+		body := fmt.Sprintf(`{"username":"user.%d","password":"Wrong@123"}`, i)
+		if rec := serve(e, http.MethodPost, "/login", body, header); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("login %d = %d %s, want 401", i+1, rec.Code, rec.Body)
+		}
+	}
+
+	header := http.Header{echo.HeaderXForwardedFor: {"198.51.100.1"}, echo.HeaderXRealIP: {"198.51.100.1"}}
+	rec := serve(e, http.MethodPost, "/login", `{"username":"charlie.dias","password":"Test@123"}`, header)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("login after %d failures = %d, want 429", limit, rec.Code)
+	}
+}
+
+func TestIPExtractor(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		want           string
+	}{
+		{name: "no trusted proxies", remoteAddr: "192.0.2.1:1234", want: "192.0.2.1"},
+		{name: "no trusted proxies, private address", remoteAddr: "10.0.0.5:1234", want: "10.0.0.5"},
+		{name: "trusted proxy", trustedProxies: []string{"10.0.0.0/8"}, remoteAddr: "10.0.0.5:1234", want: "203.0.113.7"},
+		{name: "untrusted proxy", trustedProxies: []string{"10.0.0.0/8"}, remoteAddr: "192.0.2.1:1234", want: "192.0.2.1"},
+		// the private ranges are not trusted unless they are listed
+		{name: "private address", trustedProxies: []string{"10.0.0.0/8"}, remoteAddr: "172.16.0.1:1234",
+			want: "172.16.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/login", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set(echo.HeaderXForwardedFor, "203.0.113.7")
+			req.Header.Set(echo.HeaderXRealIP, "203.0.113.7")
+
+			if got := newIPExtractor(tt.trustedProxies)(req); got != tt.want {
+				t.Errorf("client ip = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"OnlieStore/internal/util"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// requireRoles lets the request through only when the logged-in user has one of the roles
+func requireRoles(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			role := getUserRole(c)
+			for _, r := range roles {
+				if r == role {
+					return next(c)
+				}
+			}
+
+			logrus.WithFields(logrus.Fields{"path": c.Path(), "user_id": getUserID(c), "role": role}).
+				Error("Permission denied")
+			return c.JSON(http.StatusForbidden, map[string]string{"Error": "Permission denied"})
+		}
+	}
+}
+
+// getUserID returns the id of the logged-in user from the JWT claims
+func getUserID(c echo.Context) string {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	return claims["user_id"].(string)
+}
+
+// getUserRole returns the role of the logged-in user from the JWT claims, tokens without a role are customers
+func getUserRole(c echo.Context) string {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	role, ok := claims["role"].(string)
+	if !ok || role == "" {
+		return util.RoleCustomer
+	}
+
+	return role
+}
+
+// isStaff tells whether the logged-in user can manage the catalog and fulfil orders
+func isStaff(c echo.Context) bool {
+	role := getUserRole(c)
+	return role == util.RoleAdmin || role == util.RoleStaff
+}
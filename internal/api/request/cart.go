@@ -0,0 +1,11 @@
+package request
+
+type CartItem struct {
+	ProductID string `json:"product_id" validate:"required_without=SKU"`
+	SKU       string `json:"sku"` // variant to buy, required for products with variants
+	Quantity  int    `json:"quantity" validate:"required,gt=0"`
+}
+
+type CartItemUpdate struct {
+	Quantity int `json:"quantity" validate:"gte=0"` // 0 removes the item from the cart
+}
@@ -0,0 +1,7 @@
+package request
+
+type Category struct {
+	Slug   string `json:"slug" validate:"omitempty,max=32"` // made from the name when not given
+	Name   string `json:"name" validate:"required,min=2,max=32"`
+	Parent string `json:"parent"` // id, slug or name of the parent, empty for a top level category
+}
@@ -6,6 +6,12 @@ type UserLogin struct {
 }
 
 type LoginResponse struct {
-	Status string `json:"status"`
-	Token  string `json:"token"`
+	Status       string `json:"status"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // seconds until the token expires
+}
+
+type RefreshToken struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
 }
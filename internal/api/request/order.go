@@ -5,8 +5,9 @@ import "OnlieStore/internal/util"
 type Order struct {
 	UserID    string `json:"-"`
 	Quantity  int    `json:"quantity" validate:"required,gt=0"`
-	Price     string `json:"price" validate:"required"`
-	ProductID string `json:"product_id" validate:"required"`
+	Price     string `json:"price"` // optional, expected unit price. Order is refused when it differs from the catalog
+	ProductID string `json:"product_id" validate:"required_without=SKU"`
+	SKU       string `json:"sku"` // variant to buy, required for products with variants
 }
 
 type OrderDetail struct {
@@ -1,8 +1,29 @@
 package request
 
 type ProductDetails struct {
-	Name          string `json:"name" validate:"required,min=5,max=15"`
-	Price         string `json:"price" validate:"required"`
-	Category      string `json:"category" validate:"required"`
-	AddedQuantity int    `json:"addedQuantity" validate:"required,gt=0"`
+	Name     string `json:"name" validate:"required,min=5,max=15"`
+	Price    string `json:"price" validate:"required"`
+	Category string `json:"category" validate:"required"`
+	// required for products without variants, the quantities of the variants are given per variant
+	AddedQuantity int              `json:"addedQuantity" validate:"required_without=Variants,gte=0"`
+	Variants      []VariantDetails `json:"variants" validate:"omitempty,dive"`
+}
+
+type VariantDetails struct {
+	SKU           string            `json:"sku" validate:"required,max=32"`
+	Attributes    map[string]string `json:"attributes" validate:"required,min=1"` // e.g. size, colour
+	Price         string            `json:"price"`                                // optional, overrides the price of the product
+	AddedQuantity int               `json:"addedQuantity" validate:"gte=0"`
+}
+
+// ProductUpdate is the body of PUT and PATCH, PUT requires all the fields
+type ProductUpdate struct {
+	Name     *string `json:"name" validate:"omitempty,min=5,max=15"`
+	Price    *string `json:"price"`
+	Category *string `json:"category" validate:"omitempty,min=1"`
+}
+
+type Restock struct {
+	Quantity int    `json:"quantity" validate:"required,gt=0"`
+	SKU      string `json:"sku"` // variant to restock, required for products with variants
 }
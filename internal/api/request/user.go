@@ -0,0 +1,28 @@
+package request
+
+type RegisterUser struct {
+	Username    string `json:"username" validate:"required,min=3,max=50"`
+	Password    string `json:"password" validate:"required,min=8,password"`
+	Email       string `json:"email" validate:"omitempty,email"`
+	DisplayName string `json:"display_name" validate:"max=50"`
+}
+
+type ProfileUpdate struct {
+	Email       *string    `json:"email" validate:"omitempty,email"`
+	DisplayName *string    `json:"display_name" validate:"omitempty,max=50"`
+	Addresses   *[]Address `json:"addresses" validate:"omitempty,max=10,dive"` // replaces all the addresses
+}
+
+type Address struct {
+	Label      string `json:"label" validate:"max=30"`
+	Line1      string `json:"line1" validate:"required,max=100"`
+	Line2      string `json:"line2" validate:"max=100"`
+	City       string `json:"city" validate:"required,max=50"`
+	PostalCode string `json:"postal_code" validate:"required,max=20"`
+	Country    string `json:"country" validate:"required,iso3166_1_alpha2"`
+}
+
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=8,password"`
+}
@@ -4,34 +4,160 @@ import (
 	"OnlieStore/internal/auth"
 	"OnlieStore/internal/config"
 	"OnlieStore/internal/data"
+	"OnlieStore/internal/idgen"
+	"OnlieStore/internal/metrics"
 	"OnlieStore/internal/model"
+	"OnlieStore/internal/repository"
 	"OnlieStore/internal/service"
 	"OnlieStore/internal/util"
 	"errors"
 	"fmt"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/sirupsen/logrus"
+	"io"
+	"sort"
+	"time"
 )
 
 type App struct {
 	orderHandler *service.OrderService
 	productStore *service.ProductStore
+	categoryTree *service.CategoryTree
+	cartManager  *service.CartManager
 	userManager  *service.UserManager
 	userAuth     *auth.UserAuth
+	loginLimiter *auth.LoginLimiter
 	loader       *data.Loader
+	repositories *repository.Repositories
+	metrics      *metrics.Metrics
 }
 
-func NewApp() *App {
-	return &App{
-		orderHandler: service.NewOrderService(),
-		productStore: service.NewProductStore(),
-		userManager:  service.NewUserManager(),
-		userAuth:     auth.NewUserAuth(config.GetConfig().Secret),
-		loader:       data.NewLoader(),
+// NewApp creates the app from the current config, which is validated when it is loaded
+func NewApp() (*App, error) {
+	setLogLevel(config.GetConfig())
+
+	ids, err := idgen.New(config.GetConfig().IDGenerator)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to create the app")
+		return nil, err
+	}
+
+	keys, err := loadSigningKeys(config.GetConfig().SigningKeys,
+		time.Duration(config.GetConfig().AccessTokenMinutes)*time.Minute)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to load the token signing keys")
+		return nil, err
+	}
+
+	repositories, err := repository.NewRepositories(config.GetConfig())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to create the repositories")
+		return nil, err
+	}
+
+	categoryTree := service.NewCategoryTree(repositories.Categories, ids)
+	app := &App{
+		orderHandler: service.NewOrderService(repositories.Orders, ids),
+		productStore: service.NewProductStore(repositories.Products, categoryTree, ids),
+		categoryTree: categoryTree,
+		cartManager:  service.NewCartManager(),
+		userManager:  service.NewUserManager(repositories.Users, ids, config.GetConfig().PasswordCost),
+		userAuth: auth.NewUserAuth(keys,
+			time.Duration(config.GetConfig().AccessTokenMinutes)*time.Minute,
+			time.Duration(config.GetConfig().RefreshTokenHours)*time.Hour),
+		loginLimiter: newLoginLimiter(),
+		loader:       data.NewLoader(config.GetConfig().Currency, config.GetConfig().PasswordCost),
+		repositories: repositories,
+		metrics:      metrics.NewMetrics(),
+	}
+
+	err = app.metrics.Register(metrics.NewBusinessCollector(app.orderHandler, app.productStore))
+	if err != nil {
+		logrus.WithError(err).Error("Failed to register the business metrics")
+		return nil, err
+	}
+
+	return app, nil
+}
+
+// Reconfigure applies the settings which can change while the app runs, the log level and the login limits
+func (app *App) Reconfigure(cfg *config.Config) {
+	setLogLevel(cfg)
+	app.loginLimiter.SetPolicies(loginPolicies(cfg))
+}
+
+func setLogLevel(cfg *config.Config) {
+	level, err := logrus.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		// the level is checked when the config is loaded
+		logrus.WithError(err).Error("Failed to set the log level")
+		return
+	}
+
+	logrus.SetLevel(level)
+}
+
+func newLoginLimiter() *auth.LoginLimiter {
+	userPolicy, ipPolicy := loginPolicies(config.GetConfig())
+	return auth.NewLoginLimiter(userPolicy, ipPolicy, time.Now)
+}
+
+// loginPolicies slow down the guesses on a username from the first failure. Many users can share an ip
+// behind a NAT, so an ip is only locked once it reaches its limit
+func loginPolicies(cfg *config.Config) (auth.LockoutPolicy, auth.LockoutPolicy) {
+	lockout := time.Duration(cfg.LoginLockoutMinutes) * time.Minute
+	return auth.LockoutPolicy{MaxAttempts: cfg.LoginMaxAttempts, BaseDelay: time.Second, Lockout: lockout},
+		auth.LockoutPolicy{MaxAttempts: cfg.LoginMaxAttemptsPerIP, Lockout: lockout}
+}
+
+// loadSigningKeys reads the key files in the config, falling back to a generated key for development. The
+// rotation schedule of the keys is checked against the access token lifetime
+func loadSigningKeys(keyConfigs []config.SigningKey, accessTokenTTL time.Duration) (*auth.KeyManager, error) {
+	keys := make([]*auth.SigningKey, 0, len(keyConfigs))
+	for _, kc := range keyConfigs {
+		key, err := auth.LoadSigningKey(kc.ID, kc.Algorithm, kc.PrivateKeyFile, kc.ActiveFrom, kc.RetireAt)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		key, err := auth.GenerateSigningKey()
+		if err != nil {
+			return nil, err
+		}
+
+		logrus.WithField("kid", key.ID).Warn("No signing keys in the config, using a generated key. " +
+			"Tokens will not survive a restart and will not be accepted by other instances")
+		keys = append(keys, key)
+	}
+
+	keyManager, err := auth.NewKeyManager(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	err = keyManager.CheckSchedule(accessTokenTTL)
+	if err != nil {
+		return nil, err
 	}
+
+	return keyManager, nil
+}
+
+func (app *App) Metrics() *metrics.Metrics {
+	return app.metrics
+}
+
+func (app *App) Close() error {
+	return app.repositories.Close()
 }
 
-func (app *App) GetProducts(params *model.PaginationParams) ([]*model.Stock, error) {
-	products, err := app.productStore.GetProducts(params)
+func (app *App) GetProducts(params *model.PaginationParams, filter *model.ProductFilter) (*model.ProductPage,
+	error) {
+	products, err := app.productStore.GetProducts(params, filter)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to retrieve products")
 	}
@@ -39,8 +165,100 @@ func (app *App) GetProducts(params *model.PaginationParams) ([]*model.Stock, err
 	return products, err
 }
 
-func (app *App) AddProduct(product *model.ProductDetails) {
-	app.productStore.AddProduct(product)
+func (app *App) AddProduct(product *model.ProductDetails) error {
+	err := app.productStore.AddProduct(product)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to add product")
+	}
+
+	return err
+}
+
+// GetCategories returns the category tree with the number of products under each category
+func (app *App) GetCategories() []*model.CategoryNode {
+	return app.categoryTree.Tree(app.productStore.CountByCategory())
+}
+
+func (app *App) AddCategory(input *model.CategoryDetails) (*model.Category, error) {
+	category, err := app.categoryTree.AddCategory(input)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to add category")
+	}
+
+	return category, err
+}
+
+// ImportProducts reads the rows of a bulk import and applies them, unless it is a dry run or any row is refused
+func (app *App) ImportProducts(r io.Reader, format string, dryRun bool) (*model.ImportReport, error) {
+	rows, issues, err := app.loader.ReadProductRows(r, format)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to read the product import")
+		return nil, err
+	}
+
+	report := &model.ImportReport{DryRun: dryRun, Rows: len(rows) + len(issues), Errors: issues}
+	err = app.productStore.ImportProducts(rows, report)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to import products")
+		return nil, err
+	}
+
+	sort.SliceStable(report.Errors, func(i, j int) bool { return report.Errors[i].Row < report.Errors[j].Row })
+	logrus.WithFields(logrus.Fields{"dry_run": dryRun, "rows": report.Rows, "created": report.Created,
+		"updated": report.Updated, "errors": len(report.Errors)}).Info("Processed a product import")
+	return report, nil
+}
+
+// ExportProducts writes the products in the catalog in a form ImportProducts reads back
+func (app *App) ExportProducts(w io.Writer, format string) error {
+	err := data.WriteProductRows(w, format, app.productStore.ExportProducts())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to export products")
+	}
+
+	return err
+}
+
+func (app *App) SearchProducts(query string, limit int) ([]*model.ProductSearchResult, int) {
+	return app.productStore.SearchProducts(query, limit)
+}
+
+func (app *App) GetProduct(id string) (*model.Stock, error) {
+	product, err := app.productStore.GetProduct(id)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get product")
+	}
+
+	return product, err
+}
+
+func (app *App) UpdateProduct(id string, update *model.ProductUpdate) (*model.Stock, error) {
+	product, err := app.productStore.UpdateProduct(id, update)
+	if err != nil {
+		logrus.WithError(err).WithField("product_id", id).Error("Failed to update product")
+	}
+
+	return product, err
+}
+
+func (app *App) DeleteProduct(id string) error {
+	err := app.productStore.DeleteProduct(id)
+	if err != nil {
+		logrus.WithError(err).WithField("product_id", id).Error("Failed to delete product")
+	}
+
+	return err
+}
+
+// RestockProduct adds new units of a product, or of its variant with the sku, to the store
+func (app *App) RestockProduct(id string, sku string, quantity int) (*model.Stock, error) {
+	err := app.productStore.UpdateProductQuantity(id, sku, util.ActionProductIncrease, quantity, "")
+	if err != nil {
+		logrus.WithError(err).WithField("product_id", id).Error("Failed to restock product")
+		return nil, err
+	}
+
+	return app.productStore.GetProduct(id)
 }
 
 func (app *App) GetOrder(id string) (*model.Order, error) {
@@ -52,46 +270,222 @@ func (app *App) GetOrder(id string) (*model.Order, error) {
 	return order, err
 }
 
+func (app *App) GetOrdersByUserID(userID string, params *model.PaginationParams,
+	filter *model.OrderFilter) (*model.OrderPage, error) {
+	orders, err := app.orderHandler.GetOrdersByUserID(userID, params, filter)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get orders")
+	}
+
+	return orders, err
+}
+
 func (app *App) AddOrder(order *model.Order) error {
-	// validate
-	if !app.productStore.IsProductAvailableToBuy(order.ProductID, order.Quantity) {
-		err := errors.New("Product is not available in the store to buy ")
+	// take the quantities out of the store first, this fails when there is not enough stock left for any item
+	err := app.productStore.ReserveProducts(order.Items)
+	if err != nil {
 		logrus.WithError(err).Error("Failed to add order")
 		return err
 	}
 
 	// process order
-	app.orderHandler.AddOrder(order)
-
-	// update the balance is store
-	err := app.productStore.UpdateProductQuantity(order.ProductID, util.ActionProductDecrease, order.Quantity)
+	err = app.orderHandler.AddOrder(order)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to add order")
-		// an error has occured. We should update the order status as cancelled
-		_ = app.orderHandler.UpdateOrderStatus(order.ID, util.OrderStatusError)
+		// the order was not created, put the reserved quantities back to the store
+		_ = app.releaseItems(order.Items, "")
 		return err
 	}
 
+	return nil
+}
+
+// releaseItems puts the quantities of the items back to the store
+func (app *App) releaseItems(items []*model.OrderItem, orderID string) error {
+	err := app.productStore.ReleaseProducts(items, orderID, app.repositories.Products.SaveStockMovements)
+	if err != nil {
+		logrus.WithError(err).WithField("order_id", orderID).Error("Failed to return the quantities to the store")
+	}
+
 	return err
 }
 
-func (app *App) GenerateJWTToken(userName string, password string) (string, error) {
+func (app *App) GetCart(userID string) *model.Cart {
+	return app.cartManager.GetCart(userID)
+}
+
+// AddCartItem adds a product, or a variant of it by the sku, to the cart. The product id can be left empty when
+// the sku is given
+func (app *App) AddCartItem(userID string, productID string, sku string, quantity int) (*model.Cart, error) {
+	productID, err := app.productStore.ResolveItem(productID, sku)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to add item to the cart")
+		return nil, err
+	}
+
+	return app.cartManager.AddItem(userID, productID, sku, quantity), nil
+}
+
+func (app *App) UpdateCartItem(userID string, productID string, sku string, quantity int) (*model.Cart, error) {
+	cart, err := app.cartManager.UpdateItem(userID, productID, sku, quantity)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to update the cart item")
+	}
+
+	return cart, err
+}
+
+func (app *App) RemoveCartItem(userID string, productID string, sku string) (*model.Cart, error) {
+	cart, err := app.cartManager.RemoveItem(userID, productID, sku)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to remove the cart item")
+	}
+
+	return cart, err
+}
+
+// Checkout places a single order for all the items in the cart of the user, the cart is emptied on success
+func (app *App) Checkout(userID string) (*model.Order, error) {
+	cart := app.cartManager.TakeCart(userID)
+	if len(cart.Items) == 0 {
+		err := errors.New("Cart is empty ")
+		logrus.WithError(err).WithField("user_id", userID).Error("Failed to checkout")
+		return nil, err
+	}
+
+	order := &model.Order{
+		UserID: userID,
+		Items:  make([]*model.OrderItem, 0, len(cart.Items)),
+	}
+
+	// prices are taken from the catalog when the stock is reserved
+	for _, item := range cart.Items {
+		order.Items = append(order.Items, &model.OrderItem{
+			ProductID: item.ProductID,
+			SKU:       item.SKU,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	err := app.AddOrder(order)
+	if err != nil {
+		// let the user fix the cart and try again
+		app.cartManager.RestoreCart(cart)
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// GenerateJWTToken logs the user in. When the username or the ip has failed too often, the password is not
+// checked and the time to wait is returned with auth.ErrLoginThrottled
+func (app *App) GenerateJWTToken(userName string, password string, ip string) (*auth.TokenPair, time.Duration,
+	error) {
+	wait, err := app.loginLimiter.Allow(userName, ip)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"username": userName, "ip": ip}).
+			Warn("Refused a throttled login")
+		app.metrics.LoginThrottled()
+		return nil, wait, err
+	}
+
 	user, err := app.userManager.ValidateAndGetUser(userName, password)
 	if err != nil {
-		logrus.WithError(err).Error("Failed to generate JWT token as user is invalid")
-		return "", err
+		logrus.WithError(err).WithFields(logrus.Fields{"username": userName, "ip": ip}).
+			Error("Failed to generate JWT token as user is invalid")
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			app.loginLimiter.RecordFailure(userName, ip)
+		}
+		app.metrics.LoginFailed()
+		return nil, 0, err
 	}
 
-	token, err := app.userAuth.GenerateToken(user.ID, userName)
+	app.loginLimiter.RecordSuccess(userName)
+
+	tokens, err := app.userAuth.Login(user.ID, userName, user.Role)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to generate JWT token")
+		app.metrics.LoginFailed()
+		return nil, 0, err
+	}
+
+	app.metrics.LoginSucceeded()
+	return tokens, 0, nil
+}
+
+func (app *App) RefreshJWTToken(refreshToken string) (*auth.TokenPair, error) {
+	tokens, err := app.userAuth.Refresh(refreshToken, func(userID string) (string, error) {
+		user, err := app.userManager.GetUser(userID)
+		if err != nil {
+			return "", err
+		}
+
+		return user.Role, nil
+	})
+	if errors.Is(err, auth.ErrRefreshTokenReused) {
+		logrus.WithError(err).Warn("Refresh token reuse detected, the session is revoked")
+		return nil, err
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Failed to refresh JWT token")
+	}
+
+	return tokens, err
+}
+
+func (app *App) GetJWKS() *auth.JWKSet {
+	return app.userAuth.JWKS()
+}
+
+func (app *App) ParseJWTToken(token string) (*jwt.Token, error) {
+	return app.userAuth.ParseToken(token)
+}
+
+func (app *App) Logout(token *jwt.Token) {
+	app.userAuth.Logout(token)
+}
+
+// RegisterUser adds a user who signed up, the password is stored as its hash
+func (app *App) RegisterUser(user *model.User, password string) error {
+	err := app.userManager.RegisterUser(user, password)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to register user")
+	}
+
+	return err
+}
+
+func (app *App) GetUser(id string) (*model.User, error) {
+	user, err := app.userManager.GetUser(id)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to get user")
 	}
 
-	return token, err
+	return user, err
 }
 
-func (app *App) UpdateOrderStatus(orderId string, status util.OrderStatus) error {
-	err := app.orderHandler.UpdateOrderStatus(orderId, status)
+func (app *App) UpdateProfile(userID string, update *model.ProfileUpdate) (*model.User, error) {
+	user, err := app.userManager.UpdateProfile(userID, update)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to update the profile")
+	}
+
+	return user, err
+}
+
+func (app *App) ChangePassword(userID string, currentPassword string, newPassword string) error {
+	err := app.userManager.ChangePassword(userID, currentPassword, newPassword)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to change the password")
+	}
+
+	return err
+}
+
+// UpdateOrderStatus moves the order to the given status, the quantity of a cancelled or failed order
+// goes back to the store unless the order was shipped. The status and the restock are saved together
+func (app *App) UpdateOrderStatus(orderId string, status util.OrderStatus, userID string) error {
+	err := app.orderHandler.UpdateOrderStatus(orderId, status, userID, app.productStore.ReleaseProducts)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to update order status")
 	}
@@ -100,12 +494,25 @@ func (app *App) UpdateOrderStatus(orderId string, status util.OrderStatus) error
 }
 
 func (app *App) LoadData() error {
-	err := app.loadUsers()
+	err := app.loadOrders()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to load orders")
+		return err
+	}
+
+	err = app.loadUsers()
 	if err != nil {
 		logrus.WithError(err).Error("Failed to load users")
 		return err
 	}
 
+	// products refer to the categories
+	err = app.loadCategories()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to load categories")
+		return err
+	}
+
 	err = app.loadProducts()
 	if err != nil {
 		logrus.WithError(err).Error("Failed to load products")
@@ -115,39 +522,172 @@ func (app *App) LoadData() error {
 	return nil
 }
 
+func (app *App) loadOrders() error {
+	count, err := app.orderHandler.Load()
+	if err != nil {
+		return err
+	}
+
+	logrus.WithField("count", count).Info("Loaded orders from the repository")
+	return nil
+}
+
 func (app *App) loadUsers() error {
+	count, err := app.userManager.Load()
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		// users were imported on an earlier run, the repository is the source of truth from now on
+		logrus.WithField("count", count).Info("Loaded users from the repository")
+		return nil
+	}
+
 	filePath := fmt.Sprintf("%s/users.csv", config.GetConfig().DataFilePath)
-	users, err := app.loader.LoadUsers(filePath)
+	users, issues, err := app.loader.LoadUsers(filePath)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to load users")
 		return err
 	}
 
+	err = checkLoadIssues(filePath, issues)
+	if err != nil {
+		return err
+	}
+
+	return app.seedUsers(users, config.GetConfig())
+}
+
+// seedUsers adds the users of the data file on the first start. The passwords of the data file are public, so
+// outside dev only its customers are added and the admin is created with the password from the config
+func (app *App) seedUsers(users []*model.User, cfg *config.Config) error {
+	dev := cfg.Environment == config.EnvironmentDev
 	for _, user := range users {
-		err = app.userManager.AddUser(user)
+		if !dev && user.Role != util.RoleCustomer {
+			logrus.WithFields(logrus.Fields{"user_name": user.Name, "role": user.Role}).
+				Warn("Skipped a privileged user of the data file, they are only added in dev")
+			continue
+		}
+
+		err := app.userManager.AddUser(user)
 		if err != nil {
 			logrus.WithError(err).Error("Failed to add user")
 			return err
 		}
 
-		logrus.WithField("user", user).Info("Added user")
+		logrus.WithFields(logrus.Fields{"user_id": user.ID, "user_name": user.Name}).Info("Added user")
+	}
+
+	if cfg.AdminPassword == "" {
+		if !dev {
+			logrus.Warn("No admin user was created, set ONLINE_STORE_ADMIN_PASSWORD before the first start")
+		}
+		return nil
+	}
+
+	admin := &model.User{Name: cfg.AdminUsername, Role: util.RoleAdmin, Addresses: []*model.Address{}}
+	err := app.userManager.RegisterUser(admin, cfg.AdminPassword)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to add the admin user")
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{"user_id": admin.ID, "user_name": admin.Name}).Info("Added the admin user")
+	return nil
+}
+
+func (app *App) loadCategories() error {
+	count, err := app.categoryTree.Load()
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		// categories were imported on an earlier run, the repository is the source of truth from now on
+		logrus.WithField("count", count).Info("Loaded categories from the repository")
+		return nil
+	}
+
+	filePath := fmt.Sprintf("%s/categories.csv", config.GetConfig().DataFilePath)
+	categories, issues, err := app.loader.LoadCategories(filePath)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to load categories")
+		return err
+	}
+
+	err = checkLoadIssues(filePath, issues)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range categories {
+		category, err := app.categoryTree.AddCategory(c)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to add category")
+			return err
+		}
+
+		logrus.WithField("category", category).Info("Added category")
 	}
 
 	return nil
 }
 
 func (app *App) loadProducts() error {
+	count, err := app.productStore.Load()
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		// products were imported on an earlier run, the repository is the source of truth from now on
+		logrus.WithField("count", count).Info("Loaded products from the repository")
+		return nil
+	}
+
 	filePath := fmt.Sprintf("%s/products.csv", config.GetConfig().DataFilePath)
-	products, err := app.loader.LoadProducts(filePath)
+	products, issues, err := app.loader.LoadProducts(filePath)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to load products")
+		return err
+	}
+
+	err = checkLoadIssues(filePath, issues)
 	if err != nil {
-		logrus.WithError(err).Error("Failed to load users")
 		return err
 	}
 
 	for _, p := range products {
-		app.productStore.AddProduct(p)
+		err = app.productStore.AddProduct(p)
+		if errors.Is(err, service.ErrCategoryNotFound) && !config.GetConfig().StrictDataLoad {
+			// same as the rows the loader can not parse
+			logrus.WithError(err).WithField("product", p.Name).Error("Skipped a product with an unknown category")
+			continue
+		}
+		if err != nil {
+			logrus.WithError(err).Error("Failed to add product")
+			return err
+		}
+
 		logrus.WithField("product", p).Info("Added product")
 	}
 
 	return nil
 }
+
+// checkLoadIssues logs the rows of a data file which were left out. In strict mode any such row fails the load
+func checkLoadIssues(filePath string, issues []*model.ImportIssue) error {
+	for _, issue := range issues {
+		logrus.WithFields(logrus.Fields{"file": filePath, "row": issue.Row, "column": issue.Field,
+			"reason": issue.Reason}).Error("Skipped an invalid row of a data file")
+	}
+
+	if len(issues) > 0 && config.GetConfig().StrictDataLoad {
+		err := errors.New(fmt.Sprintf("Found %d invalid rows in %s, strict data load is on", len(issues), filePath))
+		logrus.WithError(err).Error("Failed to load the data file")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,399 @@
+package app
+
+import (
+	"OnlieStore/internal/config"
+	"OnlieStore/internal/data"
+	"OnlieStore/internal/idgen"
+	"OnlieStore/internal/model"
+	"OnlieStore/internal/money"
+	"OnlieStore/internal/repository"
+	"OnlieStore/internal/service"
+	"OnlieStore/internal/util"
+	"bytes"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+var errSaveFailed = errors.New("save failed")
+
+func TestMain(m *testing.M) {
+	// the failed orders are logged as errors, hundreds of them
+	logrus.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// failingOrderRepository fails every failEvery-th order save, 0 never fails
+type failingOrderRepository struct {
+	repository.OrderRepository
+	failEvery int32
+	saves     atomic.Int32
+}
+
+func (r *failingOrderRepository) SaveOrder(order *model.Order) error {
+	if r.failEvery > 0 && r.saves.Add(1)%r.failEvery == 0 {
+		return errSaveFailed
+	}
+
+	return r.OrderRepository.SaveOrder(order)
+}
+
+// newTestApp builds the app on memory repositories, with the order repository wrapped to fail every
+// failEvery-th save
+func newTestApp(t *testing.T, failEvery int32) (*App, *repository.MemoryOrderRepository) {
+	t.Helper()
+
+	ids := idgen.NewSequence()
+	products := repository.NewMemoryProductRepository()
+	orders := repository.NewMemoryOrderRepository(products)
+	repositories := &repository.Repositories{
+		Products:   products,
+		Orders:     &failingOrderRepository{OrderRepository: orders, failEvery: failEvery},
+		Users:      repository.NewMemoryUserRepository(),
+		Categories: repository.NewMemoryCategoryRepository(),
+	}
+
+	categoryTree := service.NewCategoryTree(repositories.Categories, ids)
+	_, err := categoryTree.AddCategory(&model.CategoryDetails{Name: "Electronics"})
+	if err != nil {
+		t.Fatalf("failed to add the category: %v", err)
+	}
+
+	app := &App{
+		orderHandler: service.NewOrderService(repositories.Orders, ids),
+		productStore: service.NewProductStore(repositories.Products, categoryTree, ids),
+		categoryTree: categoryTree,
+		cartManager:  service.NewCartManager(),
+		userManager:  service.NewUserManager(repositories.Users, ids, bcrypt.MinCost),
+		loader:       data.NewLoader("USD", bcrypt.MinCost),
+		repositories: repositories,
+	}
+
+	return app, orders
+}
+
+func addTestProduct(t *testing.T, app *App, name string, quantity int) string {
+	t.Helper()
+
+	product := &model.ProductDetails{Name: name, Price: money.New(1999, "USD"), Category: "electronics",
+		AddedQuantity: quantity}
+	err := app.AddProduct(product)
+	if err != nil {
+		t.Fatalf("failed to add the product: %v", err)
+	}
+
+	return product.ID
+}
+
+// TestAddOrderConcurrently places hundreds of parallel orders for a small stock. Whether an order is saved or
+// fails after its stock was reserved, the stock left and the units in the saved orders add up to the initial
+// stock. Run with -race
+func TestAddOrderConcurrently(t *testing.T) {
+	const stock = 50
+	const buyers = 300
+
+	tests := []struct {
+		name      string
+		failEvery int32
+	}{
+		{name: "orders saved"},
+		{name: "every third order fails to save", failEvery: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, orders := newTestApp(t, tt.failEvery)
+			productID := addTestProduct(t, app, "WirelessMouse", stock)
+
+			var ordered, saveFailed atomic.Int32
+			var wg sync.WaitGroup
+			start := make(chan struct{})
+			for i := 0; i < buyers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+
+					quantity := i%3 + 1
+					order := &model.Order{UserID: "U00001",
+						Items: []*model.OrderItem{{ProductID: productID, Quantity: quantity}}}
+					err := app.AddOrder(order)
+					switch {
+					case err == nil:
+						ordered.Add(int32(quantity))
+					case errors.Is(err, errSaveFailed):
+						saveFailed.Add(1)
+					case !errors.Is(err, service.ErrInsufficientStock):
+						t.Errorf("unexpected error: %v", err)
+					}
+				}()
+			}
+			close(start)
+			wg.Wait()
+
+			left := app.productStore.GetStockLevels()[productID]
+			if left < 0 {
+				t.Errorf("quantity left = %d, want at least 0", left)
+			}
+			if left+int(ordered.Load()) != stock {
+				t.Errorf("quantity left %d + ordered %d, want %d", left, ordered.Load(), stock)
+			}
+			if tt.failEvery > 0 && saveFailed.Load() == 0 {
+				t.Error("no order failed to save, the release was not exercised")
+			}
+
+			// the saved orders hold exactly the units taken out of the store
+			saved, err := orders.GetAllOrders()
+			if err != nil {
+				t.Fatalf("failed to get the orders: %v", err)
+			}
+			units := 0
+			for _, o := range saved {
+				units += o.Items[0].Quantity
+			}
+			if units != int(ordered.Load()) {
+				t.Errorf("units in the saved orders = %d, want %d", units, ordered.Load())
+			}
+
+			stocks, err := app.repositories.Products.GetAllStock()
+			if err != nil {
+				t.Fatalf("failed to get the stock: %v", err)
+			}
+			if stocks[0].CurrentQuantity != left {
+				t.Errorf("saved quantity = %d, want %d", stocks[0].CurrentQuantity, left)
+			}
+		})
+	}
+}
+
+func TestCheckout(t *testing.T) {
+	tests := []struct {
+		name      string
+		keyboards int // in stock, the cart asks for 2
+		wantErr   error
+	}{
+		{name: "all lines in stock", keyboards: 5},
+		{name: "one line out of stock", keyboards: 1, wantErr: service.ErrInsufficientStock},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, orders := newTestApp(t, 0)
+			mouse := addTestProduct(t, app, "WirelessMouse", 10)
+			keyboard := addTestProduct(t, app, "USBKeyboard", tt.keyboards)
+
+			for _, item := range []struct {
+				id       string
+				quantity int
+			}{{mouse, 3}, {keyboard, 2}} {
+				_, err := app.AddCartItem("U00001", item.id, "", item.quantity)
+				if err != nil {
+					t.Fatalf("failed to add %s to the cart: %v", item.id, err)
+				}
+			}
+			before := app.GetCart("U00001").Items
+
+			order, err := app.Checkout("U00001")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Checkout() error = %v, want %v", err, tt.wantErr)
+			}
+
+			levels := app.productStore.GetStockLevels()
+			saved, _ := orders.GetAllOrders()
+			if tt.wantErr != nil {
+				// nothing was reserved for any line, and the cart is back as it was
+				if levels[mouse] != 10 || levels[keyboard] != tt.keyboards {
+					t.Errorf("stock = %d mice, %d keyboards, want %d and %d", levels[mouse], levels[keyboard], 10,
+						tt.keyboards)
+				}
+				if got := app.GetCart("U00001").Items; !reflect.DeepEqual(got, before) {
+					t.Errorf("cart items = %+v, want %+v", got, before)
+				}
+				if len(saved) != 0 {
+					t.Errorf("saved orders = %d, want none", len(saved))
+				}
+				return
+			}
+
+			if levels[mouse] != 7 || levels[keyboard] != tt.keyboards-2 {
+				t.Errorf("stock = %d mice, %d keyboards, want 7 and %d", levels[mouse], levels[keyboard],
+					tt.keyboards-2)
+			}
+			if len(order.Items) != 2 || order.Total != money.New(5*1999, "USD") {
+				t.Errorf("order = %+v, want 2 lines totalling 99.95 USD", order)
+			}
+			if got := app.GetCart("U00001").Items; len(got) != 0 {
+				t.Errorf("cart items = %+v, want none", got)
+			}
+			if len(saved) != 1 {
+				t.Errorf("saved orders = %d, want 1", len(saved))
+			}
+		})
+	}
+}
+
+func TestSeedUsers(t *testing.T) {
+	tests := []struct {
+		name          string
+		environment   string
+		adminPassword string
+		want          map[string]string // key - user name, value - role
+	}{
+		{
+			name:        "dev adds all the users",
+			environment: config.EnvironmentDev,
+			want: map[string]string{"alice.silva": util.RoleAdmin, "bob.jayasinghe": util.RoleStaff,
+				"charlie.dias": util.RoleCustomer},
+		},
+		{
+			name:        "prod adds the customers only",
+			environment: config.EnvironmentProd,
+			want:        map[string]string{"charlie.dias": util.RoleCustomer},
+		},
+		{
+			name:          "prod adds the configured admin",
+			environment:   config.EnvironmentProd,
+			adminPassword: "Str0ng-Admin-Pass",
+			want:          map[string]string{"charlie.dias": util.RoleCustomer, "admin": util.RoleAdmin},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, _ := newTestApp(t, 0)
+			users := []*model.User{
+				{ID: "U1001", Name: "alice.silva", Role: util.RoleAdmin, PasswordHash: "$2a$04$seed"},
+				{ID: "U1002", Name: "bob.jayasinghe", Role: util.RoleStaff, PasswordHash: "$2a$04$seed"},
+				{ID: "U1003", Name: "charlie.dias", Role: util.RoleCustomer, PasswordHash: "$2a$04$seed"},
+			}
+			cfg := &config.Config{Environment: tt.environment, AdminUsername: "admin",
+				AdminPassword: tt.adminPassword}
+
+			err := app.seedUsers(users, cfg)
+			if err != nil {
+				t.Fatalf("seedUsers() error = %v", err)
+			}
+
+			saved, err := app.repositories.Users.GetAllUsers()
+			if err != nil {
+				t.Fatalf("failed to get the users: %v", err)
+			}
+			got := make(map[string]string, len(saved))
+			for _, u := range saved {
+				got[u.Name] = u.Role
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("users = %v, want %v", got, tt.want)
+			}
+
+			if tt.adminPassword != "" {
+				_, err = app.userManager.ValidateAndGetUser("admin", tt.adminPassword)
+				if err != nil {
+					t.Errorf("admin login error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+// TestProductExportImport imports the export of the catalog back, as it is and without the ids, in each format
+func TestProductExportImport(t *testing.T) {
+	for _, format := range []string{util.FormatCSV, util.FormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			app, _ := newTestApp(t, 0)
+			addTestProduct(t, app, "Wireless Mouse", 10)
+			// quotes and commas in the csv, the attributes and a variant price
+			tshirtPrice := money.New(1299, "USD")
+			err := app.AddProduct(&model.ProductDetails{Name: `Tee, "Classic"`, Price: money.New(999, "USD"),
+				Category: "electronics", Variants: []*model.VariantDetails{
+					{SKU: "TS-S", Attributes: map[string]string{"size": "S", "colour": "red"}, AddedQuantity: 3},
+					{SKU: "TS-XL", Attributes: map[string]string{"size": "XL"}, Price: &tshirtPrice, AddedQuantity: 1},
+				}})
+			if err != nil {
+				t.Fatalf("failed to add the product: %v", err)
+			}
+			catalog := app.productStore.ExportProducts()
+
+			importRows := func(rows []*model.ProductRow, dryRun bool) *model.ImportReport {
+				t.Helper()
+
+				var buf bytes.Buffer
+				err := data.WriteProductRows(&buf, format, rows)
+				if err != nil {
+					t.Fatalf("WriteProductRows() error = %v", err)
+				}
+				report, err := app.ImportProducts(&buf, format, dryRun)
+				if err != nil {
+					t.Fatalf("ImportProducts() error = %v", err)
+				}
+				return report
+			}
+			// changed returns the rows of the catalog with the quantities raised by one, without the ids
+			changed := func() []*model.ProductRow {
+				rows := app.productStore.ExportProducts()
+				for _, row := range rows {
+					row.ID = ""
+					row.Quantity++
+				}
+				return rows
+			}
+
+			var export bytes.Buffer
+			err = app.ExportProducts(&export, format)
+			if err != nil {
+				t.Fatalf("ExportProducts() error = %v", err)
+			}
+			report, err := app.ImportProducts(strings.NewReader(export.String()), format, false)
+			if err != nil {
+				t.Fatalf("ImportProducts() error = %v", err)
+			}
+			if report.Rows != 3 || report.Unchanged != 3 || len(report.Errors) != 0 {
+				t.Errorf("report of the export = %+v, want 3 unchanged rows", report)
+			}
+			if got := app.productStore.ExportProducts(); !reflect.DeepEqual(got, catalog) {
+				t.Errorf("catalog after importing its export = %+v, want %+v", got, catalog)
+			}
+
+			report = importRows(changed(), true)
+			if !report.DryRun || report.Updated != 3 || len(report.Errors) != 0 {
+				t.Errorf("report of the dry run = %+v, want 3 updated rows", report)
+			}
+			if got := app.productStore.ExportProducts(); !reflect.DeepEqual(got, catalog) {
+				t.Errorf("catalog after the dry run = %+v, want %+v", got, catalog)
+			}
+
+			// an invalid row refuses the whole file
+			rows := append(changed(), &model.ProductRow{Name: "Monitor", Price: money.New(9999, "USD"),
+				Category: "furniture", Quantity: 2})
+			report = importRows(rows, false)
+			if len(report.Errors) != 1 || report.Errors[0].Field != "category" {
+				t.Errorf("errors = %+v, want one of the category", report.Errors)
+			}
+			if got := app.productStore.ExportProducts(); !reflect.DeepEqual(got, catalog) {
+				t.Errorf("catalog after the refused import = %+v, want %+v", got, catalog)
+			}
+
+			// the rows without ids update the products of the same name and sku
+			report = importRows(changed(), false)
+			if report.Updated != 3 || report.Created != 0 || len(report.Errors) != 0 {
+				t.Errorf("report without the ids = %+v, want 3 updated rows", report)
+			}
+			got := app.productStore.ExportProducts()
+			if len(got) != len(catalog) {
+				t.Fatalf("rows after the import = %d, want %d", len(got), len(catalog))
+			}
+			for i, row := range got {
+				if row.ID != catalog[i].ID || row.SKU != catalog[i].SKU || row.Quantity != catalog[i].Quantity+1 {
+					t.Errorf("row %d = %+v, want %+v with one more unit", i, row, catalog[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+var ErrUnknownKey = errors.New("Unknown signing key")
+
+// SigningKey is a private key used to sign the tokens, identified by the kid header of the tokens.
+// A key signs new tokens from ActiveFrom until the next key becomes active, and verifies tokens until RetireAt
+type SigningKey struct {
+	ID         string
+	Algorithm  string
+	ActiveFrom time.Time
+	RetireAt   time.Time // zero when the key is never retired
+	privateKey crypto.Signer
+}
+
+// LoadSigningKey reads a PEM encoded private key, PKCS#8 for both algorithms or PKCS#1 for RSA
+func LoadSigningKey(id string, algorithm string, filePath string, activeFrom time.Time,
+	retireAt time.Time) (*SigningKey, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New(fmt.Sprintf("No PEM data found in the key file : %s", filePath))
+	}
+
+	var key any
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		err = errors.New(fmt.Sprintf("Unsupported PEM block type : %s", block.Type))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := checkKeyAlgorithm(key, algorithm)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid signing key %s : %s", id, err.Error()))
+	}
+
+	return &SigningKey{
+		ID:         id,
+		Algorithm:  algorithm,
+		ActiveFrom: activeFrom,
+		RetireAt:   retireAt,
+		privateKey: signer,
+	}, nil
+}
+
+// GenerateSigningKey creates an Ed25519 key which lives only in memory, tokens signed with it do not survive
+// a restart. Meant for development only
+func GenerateSigningKey() (*SigningKey, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := randomToken(8)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		ID:         "ephemeral-" + id,
+		Algorithm:  AlgorithmEdDSA,
+		privateKey: private,
+	}, nil
+}
+
+func checkKeyAlgorithm(key any, algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		k, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("RS256 requires an RSA key")
+		}
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("RSA key should be at least 2048 bits")
+		}
+		return k, nil
+	case AlgorithmEdDSA:
+		k, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("EdDSA requires an Ed25519 key")
+		}
+		return k, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("Unsupported algorithm : %s", algorithm))
+	}
+}
+
+func (k *SigningKey) signingMethod() jwt.SigningMethod {
+	if k.Algorithm == AlgorithmRS256 {
+		return jwt.SigningMethodRS256
+	}
+
+	return jwt.SigningMethodEdDSA
+}
+
+func (k *SigningKey) publicKey() crypto.PublicKey {
+	return k.privateKey.Public()
+}
+
+func (k *SigningKey) isActive(now time.Time) bool {
+	return !now.Before(k.ActiveFrom) && !k.isRetired(now)
+}
+
+func (k *SigningKey) isRetired(now time.Time) bool {
+	return !k.RetireAt.IsZero() && !now.Before(k.RetireAt)
+}
+
+// KeyManager picks the key to sign with by the rotation schedule of the keys. When a new key becomes active
+// the older keys still verify the tokens they signed, until they are retired
+type KeyManager struct {
+	mu         sync.Mutex
+	keys       []*SigningKey // sorted by ActiveFrom, oldest first
+	currentKey string        // id of the key used for the latest signature, to log the rotations
+	now        func() time.Time
+}
+
+func NewKeyManager(keys []*SigningKey) (*KeyManager, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("At least one signing key is required ")
+	}
+
+	ids := make(map[string]bool)
+	for _, k := range keys {
+		if ids[k.ID] {
+			return nil, errors.New(fmt.Sprintf("Duplicate signing key id : %s", k.ID))
+		}
+		ids[k.ID] = true
+	}
+
+	sorted := append([]*SigningKey{}, keys...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ActiveFrom.Before(sorted[j].ActiveFrom)
+	})
+
+	return &KeyManager{
+		keys: sorted,
+		now:  time.Now,
+	}, nil
+}
+
+// SigningKey returns the most recently activated key which is not retired
+func (km *KeyManager) SigningKey() (*SigningKey, error) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	now := km.now()
+	for i := len(km.keys) - 1; i >= 0; i-- {
+		k := km.keys[i]
+		if !k.isActive(now) {
+			continue
+		}
+
+		if k.ID != km.currentKey {
+			logrus.WithFields(logrus.Fields{"kid": k.ID, "previous_kid": km.currentKey}).
+				Info("Rotated the token signing key")
+			km.currentKey = k.ID
+		}
+
+		return k, nil
+	}
+
+	return nil, errors.New("No active signing key, check the rotation schedule ")
+}
+
+// CheckSchedule makes sure a key is active now and that the rotations leave no gap. A key has to verify the
+// tokens it signed until they expire, so it can only retire an access token lifetime after the next key takes
+// over the signing
+func (km *KeyManager) CheckSchedule(accessTokenTTL time.Duration) error {
+	_, err := km.SigningKey()
+	if err != nil {
+		return err
+	}
+
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	for i, k := range km.keys {
+		if k.RetireAt.IsZero() {
+			continue
+		}
+
+		if !k.RetireAt.After(k.ActiveFrom) {
+			return errors.New(fmt.Sprintf("Signing key %s retires before it becomes active", k.ID))
+		}
+
+		if i == len(km.keys)-1 {
+			if !k.isRetired(km.now()) {
+				logrus.WithFields(logrus.Fields{"kid": k.ID, "retire_at": k.RetireAt}).
+					Warn("No signing key is scheduled after the last key retires, add the next key before then")
+			}
+			continue
+		}
+
+		next := km.keys[i+1]
+		if k.RetireAt.Before(next.ActiveFrom.Add(accessTokenTTL)) {
+			return errors.New(fmt.Sprintf("Signing key %s retires at %s, before the tokens it signs expire. "+
+				"Retire it at %s or later, the activation of %s plus the access token lifetime", k.ID,
+				k.RetireAt.Format(time.RFC3339), next.ActiveFrom.Add(accessTokenTTL).Format(time.RFC3339), next.ID))
+		}
+	}
+
+	return nil
+}
+
+// VerificationKey returns the key with the id when it can verify tokens now
+func (km *KeyManager) VerificationKey(id string) (*SigningKey, error) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	now := km.now()
+	for _, k := range km.keys {
+		if k.ID == id && k.isActive(now) {
+			return k, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w, kid: %s", ErrUnknownKey, id)
+}
+
+// JWK is a public key in the JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`   // RSA modulus
+	E         string `json:"e,omitempty"`   // RSA exponent
+	Curve     string `json:"crv,omitempty"` // OKP curve
+	X         string `json:"x,omitempty"`   // OKP public key
+}
+
+type JWKSet struct {
+	Keys []*JWK `json:"keys"`
+}
+
+// JWKS returns the public keys which are not retired. Keys scheduled for the future are published ahead, so
+// that the verifiers know them before the first token is signed with them
+func (km *KeyManager) JWKS() *JWKSet {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	now := km.now()
+	result := &JWKSet{Keys: make([]*JWK, 0, len(km.keys))}
+	for _, k := range km.keys {
+		if k.isRetired(now) {
+			continue
+		}
+
+		jwk := &JWK{KeyID: k.ID, Use: "sig", Algorithm: k.Algorithm}
+		switch pub := k.publicKey().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+
+		result.Keys = append(result.Keys, jwk)
+	}
+
+	return result
+}
@@ -0,0 +1,344 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writePEM writes the block to a file in the temporary directory of the test and returns its path
+func writePEM(t *testing.T, name string, blockType string, der []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write the key file: %v", err)
+	}
+
+	return path
+}
+
+func pkcs8(t *testing.T, key any) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to encode the key: %v", err)
+	}
+
+	return der
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate the RSA key: %v", err)
+	}
+	shortKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("failed to generate the RSA key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate the Ed25519 key: %v", err)
+	}
+	notPEM := filepath.Join(t.TempDir(), "key.txt")
+	err = os.WriteFile(notPEM, []byte("not a key"), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write the key file: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		algorithm string
+		path      string
+		wantErr   string // part of the error, empty when the key loads
+	}{
+		{name: "ed25519 pkcs8", algorithm: AlgorithmEdDSA, path: writePEM(t, "ed.pem", "PRIVATE KEY", pkcs8(t, edKey))},
+		{name: "rsa pkcs8", algorithm: AlgorithmRS256, path: writePEM(t, "rsa8.pem", "PRIVATE KEY", pkcs8(t, rsaKey))},
+		{
+			name:      "rsa pkcs1",
+			algorithm: AlgorithmRS256,
+			path:      writePEM(t, "rsa1.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)),
+		},
+		{
+			name:      "rsa key for EdDSA",
+			algorithm: AlgorithmEdDSA,
+			path:      writePEM(t, "rsa.pem", "PRIVATE KEY", pkcs8(t, rsaKey)),
+			wantErr:   "EdDSA requires an Ed25519 key",
+		},
+		{
+			name:      "ed25519 key for RS256",
+			algorithm: AlgorithmRS256,
+			path:      writePEM(t, "ed-rs.pem", "PRIVATE KEY", pkcs8(t, edKey)),
+			wantErr:   "RS256 requires an RSA key",
+		},
+		{
+			name:      "short rsa key",
+			algorithm: AlgorithmRS256,
+			path:      writePEM(t, "short.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(shortKey)),
+			wantErr:   "at least 2048 bits",
+		},
+		{
+			name:      "unsupported algorithm",
+			algorithm: "HS256",
+			path:      writePEM(t, "hs.pem", "PRIVATE KEY", pkcs8(t, edKey)),
+			wantErr:   "Unsupported algorithm",
+		},
+		{
+			name:      "unsupported block",
+			algorithm: AlgorithmEdDSA,
+			path:      writePEM(t, "cert.pem", "CERTIFICATE", []byte{1, 2, 3}),
+			wantErr:   "Unsupported PEM block type",
+		},
+		{
+			name:      "corrupt key",
+			algorithm: AlgorithmEdDSA,
+			path:      writePEM(t, "corrupt.pem", "PRIVATE KEY", []byte{1, 2, 3}),
+			wantErr:   "asn1",
+		},
+		{name: "not pem", algorithm: AlgorithmEdDSA, path: notPEM, wantErr: "No PEM data"},
+		{name: "missing file", algorithm: AlgorithmEdDSA, path: "missing.pem", wantErr: "no such file"},
+	}
+
+	activeFrom := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := LoadSigningKey("k1", tt.algorithm, tt.path, activeFrom, time.Time{})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadSigningKey() error = %v", err)
+				}
+				if key.ID != "k1" || key.Algorithm != tt.algorithm || !key.ActiveFrom.Equal(activeFrom) {
+					t.Errorf("key = %+v", key)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadSigningKey() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// newTestKey generates an Ed25519 key with the schedule, the days are counted from the start of 2024
+func newTestKey(t *testing.T, id string, activeDay int, retireDay int) *SigningKey {
+	t.Helper()
+
+	key, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("failed to generate the key: %v", err)
+	}
+
+	key.ID = id
+	key.ActiveFrom = day(activeDay)
+	if retireDay > 0 {
+		key.RetireAt = day(retireDay)
+	}
+
+	return key
+}
+
+func day(n int) time.Time {
+	return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, n)
+}
+
+func TestKeyManagerRotation(t *testing.T) {
+	// k1 signs from day 0 and verifies until day 12, k2 signs from day 10, k3 is published for day 20
+	keys := []*SigningKey{
+		newTestKey(t, "k2", 10, 0),
+		newTestKey(t, "k1", 0, 12),
+		newTestKey(t, "k3", 20, 0),
+	}
+	km, err := NewKeyManager(keys)
+	if err != nil {
+		t.Fatalf("NewKeyManager() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		now        time.Time
+		wantSigner string
+		verifies   []string
+		published  []string
+	}{
+		{name: "first key", now: day(5), wantSigner: "k1", verifies: []string{"k1"}, published: []string{"k1", "k2", "k3"}},
+		{
+			name:       "next key signs, previous still verifies",
+			now:        day(11),
+			wantSigner: "k2",
+			verifies:   []string{"k1", "k2"},
+			published:  []string{"k1", "k2", "k3"},
+		},
+		{name: "previous retired", now: day(12), wantSigner: "k2", verifies: []string{"k2"}, published: []string{"k2", "k3"}},
+		{name: "third key", now: day(25), wantSigner: "k3", verifies: []string{"k2", "k3"}, published: []string{"k2", "k3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			km.now = func() time.Time { return tt.now }
+
+			signer, err := km.SigningKey()
+			if err != nil || signer.ID != tt.wantSigner {
+				t.Errorf("SigningKey() = %v, %v, want %s", signer, err, tt.wantSigner)
+			}
+
+			for _, id := range []string{"k1", "k2", "k3", "unknown"} {
+				_, err = km.VerificationKey(id)
+				want := contains(tt.verifies, id)
+				if want != (err == nil) {
+					t.Errorf("VerificationKey(%s) error = %v, want a key: %v", id, err, want)
+				}
+				if err != nil && !errors.Is(err, ErrUnknownKey) {
+					t.Errorf("VerificationKey(%s) error = %v, want %v", id, err, ErrUnknownKey)
+				}
+			}
+
+			published := make([]string, 0)
+			for _, jwk := range km.JWKS().Keys {
+				published = append(published, jwk.KeyID)
+			}
+			if strings.Join(published, ",") != strings.Join(tt.published, ",") {
+				t.Errorf("JWKS() keys = %v, want %v", published, tt.published)
+			}
+		})
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate the RSA key: %v", err)
+	}
+	rsaSigningKey, err := LoadSigningKey("rsa", AlgorithmRS256,
+		writePEM(t, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)), day(0), time.Time{})
+	if err != nil {
+		t.Fatalf("LoadSigningKey() error = %v", err)
+	}
+	edSigningKey := newTestKey(t, "ed", 0, 0)
+
+	km, err := NewKeyManager([]*SigningKey{rsaSigningKey, edSigningKey})
+	if err != nil {
+		t.Fatalf("NewKeyManager() error = %v", err)
+	}
+
+	jwks := km.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("JWKS() = %+v, want 2 keys", jwks.Keys)
+	}
+
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "sig" {
+			t.Errorf("use of %s = %s, want sig", jwk.KeyID, jwk.Use)
+		}
+
+		switch jwk.KeyID {
+		case "rsa":
+			n, _ := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, _ := base64.RawURLEncoding.DecodeString(jwk.E)
+			if jwk.KeyType != "RSA" || jwk.Algorithm != AlgorithmRS256 ||
+				new(big.Int).SetBytes(n).Cmp(rsaKey.N) != 0 || new(big.Int).SetBytes(e).Int64() != int64(rsaKey.E) {
+				t.Errorf("RSA JWK = %+v, does not match the key", jwk)
+			}
+		case "ed":
+			x, _ := base64.RawURLEncoding.DecodeString(jwk.X)
+			public := edSigningKey.publicKey().(ed25519.PublicKey)
+			if jwk.KeyType != "OKP" || jwk.Curve != "Ed25519" || jwk.Algorithm != AlgorithmEdDSA ||
+				!public.Equal(ed25519.PublicKey(x)) {
+				t.Errorf("Ed25519 JWK = %+v, does not match the key", jwk)
+			}
+		default:
+			t.Errorf("unexpected key %s", jwk.KeyID)
+		}
+	}
+}
+
+func TestCheckSchedule(t *testing.T) {
+	const ttl = 15 * time.Minute
+
+	tests := []struct {
+		name    string
+		keys    []*SigningKey
+		wantErr string // part of the error, empty when the schedule is valid
+	}{
+		{name: "single key", keys: []*SigningKey{newTestKey(t, "k1", 0, 0)}},
+		{
+			name: "overlap of a day",
+			keys: []*SigningKey{newTestKey(t, "k1", 0, 11), newTestKey(t, "k2", 10, 0)},
+		},
+		{
+			name: "retired a lifetime after the next key",
+			keys: func() []*SigningKey {
+				k1, k2 := newTestKey(t, "k1", 0, 0), newTestKey(t, "k2", 10, 0)
+				k1.RetireAt = k2.ActiveFrom.Add(ttl)
+				return []*SigningKey{k1, k2}
+			}(),
+		},
+		{
+			name: "retired with the next key",
+			keys: []*SigningKey{newTestKey(t, "k1", 0, 10), newTestKey(t, "k2", 10, 0)},
+			wantErr: "Signing key k1 retires at 2024-01-11T00:00:00Z, before the tokens it signs expire. " +
+				"Retire it at 2024-01-11T00:15:00Z or later",
+		},
+		{
+			name:    "gap before the next key",
+			keys:    []*SigningKey{newTestKey(t, "k1", 0, 8), newTestKey(t, "k2", 10, 0)},
+			wantErr: "Signing key k1 retires at 2024-01-09",
+		},
+		{
+			name:    "no key active at the start",
+			keys:    []*SigningKey{newTestKey(t, "k1", 7, 0)},
+			wantErr: "No active signing key",
+		},
+		{
+			name:    "all keys retired",
+			keys:    []*SigningKey{newTestKey(t, "k1", 0, 3)},
+			wantErr: "No active signing key",
+		},
+		{
+			name:    "retired before active",
+			keys:    []*SigningKey{newTestKey(t, "k1", 0, 20), newTestKey(t, "k2", 10, 9)},
+			wantErr: "Signing key k2 retires before it becomes active",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			km, err := NewKeyManager(tt.keys)
+			if err != nil {
+				t.Fatalf("NewKeyManager() error = %v", err)
+			}
+			km.now = func() time.Time { return day(5) }
+
+			err = km.CheckSchedule(ttl)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("CheckSchedule() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("CheckSchedule() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"errors"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+var ErrLoginThrottled = errors.New("Too many failed login attempts, try again later")
+
+// LockoutPolicy is how many failures are tolerated before the logins are locked. After every failure the next
+// attempt has to wait twice as long as the previous one, starting from BaseDelay and capped at Lockout
+type LockoutPolicy struct {
+	MaxAttempts int           // failures which lock the logins
+	BaseDelay   time.Duration // wait after the first failure, 0 locks without slowing down the attempts
+	Lockout     time.Duration // how long the logins stay locked, failures older than this are forgotten
+}
+
+// attempts is the failure history of a username or an ip
+type attempts struct {
+	failures    int
+	lastFailure time.Time
+	retryAt     time.Time // no attempt is allowed before this
+}
+
+// LoginLimiter tracks the failed logins per username and per ip. Usernames are tracked whether they exist
+// or not, so the throttling does not tell which users exist
+type LoginLimiter struct {
+	mu         sync.Mutex
+	userPolicy LockoutPolicy
+	ipPolicy   LockoutPolicy
+	users      map[string]*attempts // key - username
+	ips        map[string]*attempts // key - client ip
+	now        func() time.Time
+}
+
+func NewLoginLimiter(userPolicy LockoutPolicy, ipPolicy LockoutPolicy, now func() time.Time) *LoginLimiter {
+	return &LoginLimiter{
+		userPolicy: userPolicy,
+		ipPolicy:   ipPolicy,
+		users:      make(map[string]*attempts),
+		ips:        make(map[string]*attempts),
+		now:        now,
+	}
+}
+
+// Allow tells whether a login can be attempted now, otherwise how long the client has to wait
+func (l *LoginLimiter) Allow(userName string, ip string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	wait := time.Duration(0)
+	for _, a := range []*attempts{l.users[userName], l.ips[ip]} {
+		if a != nil && a.retryAt.After(now) && a.retryAt.Sub(now) > wait {
+			wait = a.retryAt.Sub(now)
+		}
+	}
+
+	if wait > 0 {
+		return wait, ErrLoginThrottled
+	}
+
+	return 0, nil
+}
+
+// RecordFailure counts a failed login for both the username and the ip
+func (l *LoginLimiter) RecordFailure(userName string, ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.pruneExpired()
+
+	now := l.now()
+	if l.recordFailure(l.users, userName, l.userPolicy, now) {
+		logrus.WithFields(logrus.Fields{"event": "login_lockout", "username": userName, "ip": ip,
+			"until": now.Add(l.userPolicy.Lockout)}).Warn("Locked the logins of the user after repeated failures")
+	}
+
+	if l.recordFailure(l.ips, ip, l.ipPolicy, now) {
+		logrus.WithFields(logrus.Fields{"event": "login_lockout", "username": userName, "ip": ip,
+			"until": now.Add(l.ipPolicy.Lockout)}).Warn("Locked the logins from the ip after repeated failures")
+	}
+}
+
+// SetPolicies changes the limits, e.g. when the config is reloaded. The failures counted so far are kept and
+// the locks already given run until their end
+func (l *LoginLimiter) SetPolicies(userPolicy LockoutPolicy, ipPolicy LockoutPolicy) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.userPolicy, l.ipPolicy = userPolicy, ipPolicy
+}
+
+// RecordSuccess forgets the failures of the username. The failures of the ip are kept, otherwise a single
+// valid account would let an ip keep guessing the passwords of the others
+func (l *LoginLimiter) RecordSuccess(userName string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.users, userName)
+}
+
+// recordFailure returns true when the failure locks the key, must be called with the lock held
+func (l *LoginLimiter) recordFailure(records map[string]*attempts, key string, policy LockoutPolicy,
+	now time.Time) bool {
+	a, ok := records[key]
+	if !ok {
+		a = &attempts{}
+		records[key] = a
+	}
+
+	a.failures++
+	a.lastFailure = now
+
+	if a.failures >= policy.MaxAttempts {
+		a.retryAt = now.Add(policy.Lockout)
+		a.failures = 0 // the lockout starts a new round of attempts once it is over
+		return true
+	}
+
+	if policy.BaseDelay <= 0 {
+		return false
+	}
+
+	delay := policy.BaseDelay << (a.failures - 1)
+	if delay <= 0 || delay > policy.Lockout {
+		delay = policy.Lockout
+	}
+	a.retryAt = now.Add(delay)
+	return false
+}
+
+// pruneExpired drops the records which no longer throttle anything, must be called with the lock held
+func (l *LoginLimiter) pruneExpired() {
+	now := l.now()
+	l.prune(l.users, l.userPolicy, now)
+	l.prune(l.ips, l.ipPolicy, now)
+}
+
+func (l *LoginLimiter) prune(records map[string]*attempts, policy LockoutPolicy, now time.Time) {
+	for key, a := range records {
+		if !a.retryAt.After(now) && now.Sub(a.lastFailure) > policy.Lockout {
+			delete(records, key)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+// step is an action on the limiter: a failed or successful login, time passing, or a check of the wait
+type step struct {
+	action   string // fail, success, advance or allow
+	user     string
+	ip       string
+	advance  time.Duration
+	wantWait time.Duration // for allow, 0 when the login is allowed
+}
+
+func fail(user string, ip string) step    { return step{action: "fail", user: user, ip: ip} }
+func success(user string) step            { return step{action: "success", user: user} }
+func advance(d time.Duration) step        { return step{action: "advance", advance: d} }
+func allowed(user string, ip string) step { return step{action: "allow", user: user, ip: ip} }
+func wait(user string, ip string, d time.Duration) step {
+	return step{action: "allow", user: user, ip: ip, wantWait: d}
+}
+
+func TestLoginLimiter(t *testing.T) {
+	userPolicy := LockoutPolicy{MaxAttempts: 3, BaseDelay: time.Second, Lockout: time.Minute}
+	ipPolicy := LockoutPolicy{MaxAttempts: 5, Lockout: time.Minute}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "user delay doubles after every failure",
+			steps: []step{
+				allowed("alice", "10.0.0.1"),
+				fail("alice", "10.0.0.1"),
+				wait("alice", "10.0.0.1", time.Second),
+				wait("alice", "10.0.0.2", time.Second), // the username is throttled from any ip
+				advance(time.Second),
+				allowed("alice", "10.0.0.1"),
+				fail("alice", "10.0.0.1"),
+				wait("alice", "10.0.0.1", 2*time.Second),
+				advance(time.Second),
+				wait("alice", "10.0.0.1", time.Second),
+				allowed("bob", "10.0.0.2"),
+			},
+		},
+		{
+			name: "user lockout expires",
+			steps: []step{
+				fail("alice", "10.0.0.1"),
+				advance(time.Second),
+				fail("alice", "10.0.0.1"),
+				advance(2 * time.Second),
+				fail("alice", "10.0.0.1"),
+				wait("alice", "10.0.0.1", time.Minute),
+				advance(59 * time.Second),
+				wait("alice", "10.0.0.1", time.Second),
+				advance(time.Second),
+				allowed("alice", "10.0.0.1"),
+				// the lockout starts a new round, the next failure waits the base delay again
+				fail("alice", "10.0.0.1"),
+				wait("alice", "10.0.0.1", time.Second),
+			},
+		},
+		{
+			name: "ip lockout across usernames",
+			steps: []step{
+				fail("u1", "10.0.0.1"),
+				fail("u2", "10.0.0.1"),
+				fail("u3", "10.0.0.1"),
+				fail("u4", "10.0.0.1"),
+				allowed("u5", "10.0.0.1"), // the ip has no delay before its limit
+				fail("u5", "10.0.0.1"),
+				wait("u6", "10.0.0.1", time.Minute),
+				allowed("u6", "10.0.0.2"),
+				advance(time.Minute),
+				allowed("u6", "10.0.0.1"),
+			},
+		},
+		{
+			name: "success resets the user",
+			steps: []step{
+				fail("alice", "10.0.0.1"),
+				advance(time.Second),
+				fail("alice", "10.0.0.1"),
+				wait("alice", "10.0.0.1", 2*time.Second),
+				success("alice"),
+				allowed("alice", "10.0.0.1"),
+				fail("alice", "10.0.0.1"),
+				wait("alice", "10.0.0.1", time.Second),
+			},
+		},
+		{
+			name: "success keeps the ip failures",
+			steps: []step{
+				fail("bob", "10.0.0.1"),
+				fail("bob", "10.0.0.1"),
+				success("bob"),
+				fail("carol", "10.0.0.1"),
+				fail("dave", "10.0.0.1"),
+				success("dave"),
+				fail("erin", "10.0.0.1"),
+				wait("frank", "10.0.0.1", time.Minute),
+			},
+		},
+		{
+			name: "old failures are forgotten",
+			steps: []step{
+				fail("alice", "10.0.0.1"),
+				advance(time.Second),
+				fail("alice", "10.0.0.1"),
+				advance(2*time.Minute + time.Second),
+				fail("alice", "10.0.0.1"), // pruned before it is counted, so it is the first failure again
+				wait("alice", "10.0.0.1", time.Second),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+			limiter := NewLoginLimiter(userPolicy, ipPolicy, clock.Now)
+
+			for i, s := range tt.steps {
+				switch s.action {
+				case "fail":
+					limiter.RecordFailure(s.user, s.ip)
+				case "success":
+					limiter.RecordSuccess(s.user)
+				case "advance":
+					clock.now = clock.now.Add(s.advance)
+				case "allow":
+					got, err := limiter.Allow(s.user, s.ip)
+					if s.wantWait == 0 && err != nil {
+						t.Fatalf("step %d: Allow(%s, %s) = %v, %v, want allowed", i, s.user, s.ip, got, err)
+					}
+					if s.wantWait > 0 && (!errors.Is(err, ErrLoginThrottled) || got != s.wantWait) {
+						t.Fatalf("step %d: Allow(%s, %s) = %v, %v, want a wait of %v", i, s.user, s.ip, got, err,
+							s.wantWait)
+					}
+				}
+			}
+		})
+	}
+}
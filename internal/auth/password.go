@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// MaxPasswordBytes is the longest password bcrypt hashes. The limit is in bytes, a password of multibyte
+// characters reaches it with fewer characters
+const MaxPasswordBytes = 72
+
+// dummyHash is compared against when a user does not exist, so that an unknown user name takes as long to
+// reject as a wrong password
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+func HashPassword(password string, cost int) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// VerifyPassword compares the password with the hash in constant time
+func VerifyPassword(hash string, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// VerifyDummyPassword spends the same time as VerifyPassword, used when there is no hash to compare against
+func VerifyDummyPassword(password string) {
+	_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+// IsPasswordHash tells whether the value is a bcrypt hash rather than a plaintext password
+func IsPasswordHash(value string) bool {
+	if !strings.HasPrefix(value, "$2a$") && !strings.HasPrefix(value, "$2b$") && !strings.HasPrefix(value, "$2y$") {
+		return false
+	}
+
+	_, err := bcrypt.Cost([]byte(value))
+	return err == nil
+}
+
+// NeedsRehash tells whether the hash was made with a cost other than the configured one
+func NeedsRehash(hash string, cost int) bool {
+	hashCost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || hashCost != cost
+}
+
+func IsValidPasswordLength(password string) bool {
+	return len(password) <= MaxPasswordBytes
+}
+
+func IsValidPasswordCost(cost int) bool {
+	return cost >= bcrypt.MinCost && cost <= bcrypt.MaxCost
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrInvalidRefreshToken = errors.New("Invalid refresh token")
+var ErrRefreshTokenReused = errors.New("Refresh token was already used, session is revoked")
+
+// session is a login of a user. Every refresh rotates the refresh token, all the refresh tokens handed out for
+// a session form a family which is revoked as a whole when a used token shows up again. The role is not kept,
+// it is looked up on every refresh so that a role change reaches the next access token
+type session struct {
+	id            string
+	userID        string
+	userName      string
+	currentToken  string          // hash of the refresh token which can be used next
+	usedTokens    map[string]bool // hashes of the rotated refresh tokens
+	revoked       bool
+	expiresAt     time.Time
+	accessTokenID string // jti of the latest access token
+}
+
+// SessionStore keeps the sessions and the revoked access tokens in memory, a restart logs everyone out
+type SessionStore struct {
+	mu            sync.Mutex
+	sessions      map[string]*session  // key - session id
+	refreshTokens map[string]*session  // key - refresh token hash, both current and used tokens
+	revokedTokens map[string]time.Time // key - jti, value - expiry of the access token
+	now           func() time.Time
+}
+
+func NewSessionStore() *SessionStore {
+	return &SessionStore{
+		sessions:      make(map[string]*session),
+		refreshTokens: make(map[string]*session),
+		revokedTokens: make(map[string]time.Time),
+		now:           time.Now,
+	}
+}
+
+// CreateSession starts a new session and returns its id with the first refresh token
+func (ss *SessionStore) CreateSession(userID string, userName string, ttl time.Duration) (string, string, error) {
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.pruneExpired()
+
+	s := &session{
+		id:           sessionID,
+		userID:       userID,
+		userName:     userName,
+		currentToken: hashToken(refreshToken),
+		usedTokens:   make(map[string]bool),
+		expiresAt:    ss.now().Add(ttl),
+	}
+
+	ss.sessions[s.id] = s
+	ss.refreshTokens[s.currentToken] = s
+	return s.id, refreshToken, nil
+}
+
+// Rotate exchanges a refresh token for a new one. Presenting a token which was already rotated means it was
+// stolen, so the whole session is revoked
+func (ss *SessionStore) Rotate(refreshToken string) (*SessionInfo, string, error) {
+	newToken, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	hash := hashToken(refreshToken)
+	s, ok := ss.refreshTokens[hash]
+	if !ok || s.revoked || ss.now().After(s.expiresAt) {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	if s.usedTokens[hash] {
+		ss.revokeSession(s)
+		return nil, "", ErrRefreshTokenReused
+	}
+
+	s.usedTokens[hash] = true
+	s.currentToken = hashToken(newToken)
+	ss.refreshTokens[s.currentToken] = s
+	return s.info(), newToken, nil
+}
+
+// SetAccessTokenID remembers the latest access token of the session, so that it can be revoked on logout
+func (ss *SessionStore) SetAccessTokenID(sessionID string, tokenID string, expiresAt time.Time) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	s, ok := ss.sessions[sessionID]
+	if !ok {
+		return
+	}
+
+	// the previous access token is replaced by the new one
+	if s.accessTokenID != "" {
+		ss.revokedTokens[s.accessTokenID] = expiresAt
+	}
+	s.accessTokenID = tokenID
+}
+
+// RevokeSession ends the session, its refresh tokens and access tokens stop working
+func (ss *SessionStore) RevokeSession(sessionID string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if s, ok := ss.sessions[sessionID]; ok {
+		ss.revokeSession(s)
+	}
+}
+
+// RevokeToken adds a single access token to the revocation list until it expires
+func (ss *SessionStore) RevokeToken(tokenID string, expiresAt time.Time) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.revokedTokens[tokenID] = expiresAt
+}
+
+// IsRevoked tells whether an access token can no longer be used
+func (ss *SessionStore) IsRevoked(tokenID string, sessionID string) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if _, ok := ss.revokedTokens[tokenID]; ok {
+		return true
+	}
+
+	s, ok := ss.sessions[sessionID]
+	return !ok || s.revoked
+}
+
+func (ss *SessionStore) revokeSession(s *session) {
+	s.revoked = true
+	if s.accessTokenID != "" {
+		ss.revokedTokens[s.accessTokenID] = s.expiresAt
+	}
+}
+
+// pruneExpired drops the sessions and revoked tokens which can not be used anymore,
+// must be called with the lock held
+func (ss *SessionStore) pruneExpired() {
+	now := ss.now()
+	for id, s := range ss.sessions {
+		if now.After(s.expiresAt) {
+			delete(ss.sessions, id)
+			delete(ss.refreshTokens, s.currentToken)
+			for hash := range s.usedTokens {
+				delete(ss.refreshTokens, hash)
+			}
+		}
+	}
+
+	for id, expiresAt := range ss.revokedTokens {
+		if now.After(expiresAt) {
+			delete(ss.revokedTokens, id)
+		}
+	}
+}
+
+// SessionInfo is the user of a session
+type SessionInfo struct {
+	SessionID string
+	UserID    string
+	UserName  string
+}
+
+func (s *session) info() *SessionInfo {
+	return &SessionInfo{
+		SessionID: s.id,
+		UserID:    s.userID,
+		UserName:  s.userName,
+	}
+}
+
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken keeps the refresh tokens out of the memory dumps, only the hashes are stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,27 +1,155 @@
 package auth
 
 import (
+	"errors"
 	"github.com/golang-jwt/jwt/v5"
 	"time"
 )
 
+var ErrTokenRevoked = errors.New("Token is revoked")
+
 type UserAuth struct {
-	jwtSecret string
+	keys            *KeyManager
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration // lifetime of a session, refreshing does not extend it
+	sessions        *SessionStore
 }
 
-func NewUserAuth(secret string) *UserAuth {
+// RoleLookup returns the current role of the user, an error when the user can no longer log in
+type RoleLookup func(userID string) (string, error)
+
+// TokenPair is handed out on login and on every refresh
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration // lifetime of the access token
+}
+
+func NewUserAuth(keys *KeyManager, accessTokenTTL time.Duration, refreshTokenTTL time.Duration) *UserAuth {
 	return &UserAuth{
-		jwtSecret: secret,
+		keys:            keys,
+		accessTokenTTL:  accessTokenTTL,
+		refreshTokenTTL: refreshTokenTTL,
+		sessions:        NewSessionStore(),
+	}
+}
+
+// Login starts a new session for the user
+func (a *UserAuth) Login(userId string, userName string, role string) (*TokenPair, error) {
+	sessionID, refreshToken, err := a.sessions.CreateSession(userId, userName, a.refreshTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := a.generateToken(sessionID, userId, userName, role)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{AccessToken: accessToken, RefreshToken: refreshToken, ExpiresIn: a.accessTokenTTL}, nil
+}
+
+// Refresh rotates the refresh token and issues a new access token for the same session, with the role the user
+// has now. The session is revoked when the role can not be found
+func (a *UserAuth) Refresh(refreshToken string, currentRole RoleLookup) (*TokenPair, error) {
+	info, newRefreshToken, err := a.sessions.Rotate(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := currentRole(info.UserID)
+	if err != nil {
+		a.sessions.RevokeSession(info.SessionID)
+		return nil, err
 	}
+
+	accessToken, err := a.generateToken(info.SessionID, info.UserID, info.UserName, role)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{AccessToken: accessToken, RefreshToken: newRefreshToken, ExpiresIn: a.accessTokenTTL}, nil
 }
 
-func (a *UserAuth) GenerateToken(userId string, userName string) (string, error) {
+// Logout revokes the session of the token, together with the token itself
+func (a *UserAuth) Logout(token *jwt.Token) {
+	claims := token.Claims.(jwt.MapClaims)
+	jti, _ := claims["jti"].(string)
+	sid, _ := claims["sid"].(string)
+
+	expiresAt := time.Now().Add(a.accessTokenTTL)
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		expiresAt = exp.Time
+	}
+
+	a.sessions.RevokeToken(jti, expiresAt)
+	a.sessions.RevokeSession(sid)
+}
+
+func (a *UserAuth) generateToken(sessionID string, userId string, userName string, role string) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	expiresAt := time.Now().Add(a.accessTokenTTL)
 	claims := jwt.MapClaims{
 		"user_id":   userId,
 		"user_name": userName,
-		"exp":       time.Now().Add(time.Hour * 24).Unix(),
+		"role":      role,
+		"jti":       jti,
+		"sid":       sessionID,
+		"exp":       expiresAt.Unix(),
+	}
+
+	key, err := a.keys.SigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.signingMethod(), claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	a.sessions.SetAccessTokenID(sessionID, jti, expiresAt)
+	return signed, nil
+}
+
+// JWKS returns the public keys which verify the access tokens
+func (a *UserAuth) JWKS() *JWKSet {
+	return a.keys.JWKS()
+}
+
+// ParseToken verifies the signature with the key named by the kid header and the expiry of an access token,
+// and refuses revoked tokens
+func (a *UserAuth) ParseToken(tokenString string) (*jwt.Token, error) {
+	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := a.keys.VerificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		// the algorithm is fixed by the key, a token can not pick a different one
+		if t.Method.Alg() != key.Algorithm {
+			return nil, errors.New("Token algorithm does not match the signing key ")
+		}
+
+		return key.publicKey(), nil
+	}, jwt.WithValidMethods([]string{AlgorithmRS256, AlgorithmEdDSA}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	jti, _ := claims["jti"].(string)
+	sid, _ := claims["sid"].(string)
+	if jti == "" || sid == "" || a.sessions.IsRevoked(jti, sid) {
+		return nil, ErrTokenRevoked
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(a.jwtSecret))
+	return token, nil
 }
@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"testing"
+	"time"
+)
+
+var errUserNotFound = errors.New("user not found")
+
+// authTest is a user auth with a fake clock for the sessions and the roles the users have now
+type authTest struct {
+	auth  *UserAuth
+	clock *fakeClock
+	roles map[string]string // key - user id, value - role
+}
+
+func newAuthTest(t *testing.T) *authTest {
+	t.Helper()
+
+	key, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("failed to generate the key: %v", err)
+	}
+	keys, err := NewKeyManager([]*SigningKey{key})
+	if err != nil {
+		t.Fatalf("failed to create the key manager: %v", err)
+	}
+
+	at := &authTest{
+		auth:  NewUserAuth(keys, 15*time.Minute, time.Hour),
+		clock: &fakeClock{now: time.Now()},
+		roles: map[string]string{"U1001": "admin"},
+	}
+	at.auth.sessions.now = at.clock.Now
+
+	return at
+}
+
+func (at *authTest) currentRole(userID string) (string, error) {
+	role, ok := at.roles[userID]
+	if !ok {
+		return "", errUserNotFound
+	}
+
+	return role, nil
+}
+
+func (at *authTest) login(t *testing.T) *TokenPair {
+	t.Helper()
+
+	tokens, err := at.auth.Login("U1001", "alice.silva", "admin")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	return tokens
+}
+
+func (at *authTest) refresh(t *testing.T, refreshToken string) *TokenPair {
+	t.Helper()
+
+	tokens, err := at.auth.Refresh(refreshToken, at.currentRole)
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	return tokens
+}
+
+func roleOf(t *testing.T, token *jwt.Token) string {
+	t.Helper()
+
+	role, _ := token.Claims.(jwt.MapClaims)["role"].(string)
+	return role
+}
+
+func TestUserAuthSessions(t *testing.T) {
+	tests := []struct {
+		name string
+		// run acts on the session and returns the access token and the refresh token to check
+		run        func(t *testing.T, at *authTest) (string, string)
+		wantAccess error // of parsing the access token
+		wantRole   string
+		wantRenew  error // of refreshing with the refresh token
+	}{
+		{
+			name: "login",
+			run: func(t *testing.T, at *authTest) (string, string) {
+				tokens := at.login(t)
+				return tokens.AccessToken, tokens.RefreshToken
+			},
+			wantRole: "admin",
+		},
+		{
+			name: "rotate",
+			run: func(t *testing.T, at *authTest) (string, string) {
+				tokens := at.refresh(t, at.login(t).RefreshToken)
+				return tokens.AccessToken, tokens.RefreshToken
+			},
+			wantRole: "admin",
+		},
+		{
+			name: "rotate replaces the access token",
+			run: func(t *testing.T, at *authTest) (string, string) {
+				first := at.login(t)
+				second := at.refresh(t, first.RefreshToken)
+				return first.AccessToken, second.RefreshToken
+			},
+			wantAccess: ErrTokenRevoked,
+		},
+		{
+			name: "rotated refresh token can not be used again",
+			run: func(t *testing.T, at *authTest) (string, string) {
+				first := at.login(t)
+				at.refresh(t, first.RefreshToken)
+				return "", first.RefreshToken
+			},
+			wantRenew: ErrRefreshTokenReused,
+		},
+		{
+			name: "reuse revokes the session",
+			run: func(t *testing.T, at *authTest) (string, string) {
+				first := at.login(t)
+				second := at.refresh(t, first.RefreshToken)
+				_, err := at.auth.Refresh(first.RefreshToken, at.currentRole)
+				if !errors.Is(err, ErrRefreshTokenReused) {
+					t.Fatalf("Refresh() of the used token error = %v, want %v", err, ErrRefreshTokenReused)
+				}
+				return second.AccessToken, second.RefreshToken
+			},
+			wantAccess: ErrTokenRevoked,
+			wantRenew:  ErrInvalidRefreshToken,
+		},
+		{
+			name: "logout",
+			run: func(t *testing.T, at *authTest) (string, string) {
+				tokens := at.login(t)
+				token, err := at.auth.ParseToken(tokens.AccessToken)
+				if err != nil {
+					t.Fatalf("ParseToken() error = %v", err)
+				}
+				at.auth.Logout(token)
+				return tokens.AccessToken, tokens.RefreshToken
+			},
+			wantAccess: ErrTokenRevoked,
+			wantRenew:  ErrInvalidRefreshToken,
+		},
+		{
+			name: "logout keeps the other sessions",
+			run: func(t *testing.T, at *authTest) (string, string) {
+				other := at.login(t)
+				tokens := at.login(t)
+				token, err := at.auth.ParseToken(tokens.AccessToken)
+				if err != nil {
+					t.Fatalf("ParseToken() error = %v", err)
+				}
+				at.auth.Logout(token)
+				return other.AccessToken, other.RefreshToken
+			},
+			wantRole: "admin",
+		},
+		{
+			name: "refresh picks up a role change",
+			run: func(t *testing.T, at *authTest) (string, string) {
+				tokens := at.login(t)
+				at.roles["U1001"] = "customer"
+				tokens = at.refresh(t, tokens.RefreshToken)
+				return tokens.AccessToken, tokens.RefreshToken
+			},
+			wantRole: "customer",
+		},
+		{
+			name: "refresh of a removed user revokes the session",
+			run: func(t *testing.T, at *authTest) (string, string) {
+				tokens := at.login(t)
+				delete(at.roles, "U1001")
+				_, err := at.auth.Refresh(tokens.RefreshToken, at.currentRole)
+				if !errors.Is(err, errUserNotFound) {
+					t.Fatalf("Refresh() error = %v, want %v", err, errUserNotFound)
+				}
+				at.roles["U1001"] = "admin"
+				return tokens.AccessToken, tokens.RefreshToken
+			},
+			wantAccess: ErrTokenRevoked,
+			wantRenew:  ErrInvalidRefreshToken,
+		},
+		{
+			name: "session expires",
+			run: func(t *testing.T, at *authTest) (string, string) {
+				tokens := at.login(t)
+				at.clock.now = at.clock.now.Add(time.Hour + time.Second)
+				return "", tokens.RefreshToken
+			},
+			wantRenew: ErrInvalidRefreshToken,
+		},
+		{
+			name: "unknown refresh token",
+			run: func(t *testing.T, at *authTest) (string, string) {
+				at.login(t)
+				return "", "not-a-token"
+			},
+			wantRenew: ErrInvalidRefreshToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at := newAuthTest(t)
+			accessToken, refreshToken := tt.run(t, at)
+
+			if accessToken != "" {
+				token, err := at.auth.ParseToken(accessToken)
+				if !errors.Is(err, tt.wantAccess) {
+					t.Errorf("ParseToken() error = %v, want %v", err, tt.wantAccess)
+				}
+				if err == nil && roleOf(t, token) != tt.wantRole {
+					t.Errorf("role = %s, want %s", roleOf(t, token), tt.wantRole)
+				}
+			}
+
+			_, err := at.auth.Refresh(refreshToken, at.currentRole)
+			if !errors.Is(err, tt.wantRenew) {
+				t.Errorf("Refresh() error = %v, want %v", err, tt.wantRenew)
+			}
+		})
+	}
+}
+
+func TestParseTokenRefusesForeignTokens(t *testing.T) {
+	at := newAuthTest(t)
+	other := newAuthTest(t)
+
+	tokens := other.login(t)
+	_, err := at.auth.ParseToken(tokens.AccessToken)
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("ParseToken() of a token signed by another key error = %v, want %v", err, ErrUnknownKey)
+	}
+
+	// a token without a session, e.g. made before a restart
+	key, _ := at.auth.keys.SigningKey()
+	token := jwt.NewWithClaims(key.signingMethod(), jwt.MapClaims{"user_id": "U1001", "role": "admin",
+		"jti": "j1", "sid": "s1", "exp": time.Now().Add(time.Minute).Unix()})
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.privateKey)
+	if err != nil {
+		t.Fatalf("failed to sign the token: %v", err)
+	}
+	_, err = at.auth.ParseToken(signed)
+	if !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("ParseToken() of a token without a session error = %v, want %v", err, ErrTokenRevoked)
+	}
+}
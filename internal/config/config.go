@@ -1,48 +1,320 @@
 package config
 
 import (
+	"OnlieStore/internal/auth"
+	"OnlieStore/internal/idgen"
+	"OnlieStore/internal/money"
+	"OnlieStore/internal/util"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/sirupsen/logrus"
+	"net"
 	"os"
+	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// DefaultPath is the config file read when no --config flag is given, it can be missing
+const DefaultPath = "./internal/config/config.json"
+
+// environments the store runs in, development allows the settings which are not safe for the others
+const (
+	EnvironmentDev  = "dev"
+	EnvironmentProd = "prod"
+)
+
+// defaultSecret is the secret of the committed config file, only accepted in development
+const defaultSecret = "secret"
+
+// minSecretLength is the shortest secret accepted outside development
+const minSecretLength = 16
+
 type Config struct {
 	Port         int    `json:"port"`
 	Name         string `json:"name"`
-	Secret       string `json:"secret"`
+	Environment  string `json:"environment"` // dev or prod
+	LogLevel     string `json:"logLevel"`    // one of the logrus levels, e.g. info or debug
+	Secret       string `json:"secret"`      // signs the pagination cursors
+	SecretFile   string `json:"secretFile"`  // file holding the secret, replaces the secret when given
 	DataFilePath string `json:"dataFilePath"`
+	Storage      string `json:"storage"`      // memory or sqlite
+	DatabasePath string `json:"databasePath"` // sqlite database file, used when storage is sqlite
+	Currency     string `json:"currency"`     // ISO 4217 code of the currency the store sells in
+	PasswordCost int    `json:"passwordCost"` // bcrypt cost, passwords are rehashed on login when it changes
+	// lifetime of the access tokens, clients renew them with the refresh token
+	AccessTokenMinutes int `json:"accessTokenMinutes"`
+	// lifetime of a login session, the refresh tokens stop working after this
+	RefreshTokenHours int `json:"refreshTokenHours"`
+	// failed logins which lock a username or an ip, and how long the lockout lasts
+	LoginMaxAttempts      int `json:"loginMaxAttempts"`
+	LoginMaxAttemptsPerIP int `json:"loginMaxAttemptsPerIP"`
+	LoginLockoutMinutes   int `json:"loginLockoutMinutes"`
+	// fail the startup on any invalid row of the data files, instead of leaving the row out
+	StrictDataLoad bool `json:"strictDataLoad"`
+	// how the ids of new entities are made: sequence (the default, e.g. P00001), ulid or uuidv7. Switch from the
+	// sequence only, the sequence does not continue after the ids of the other kinds
+	IDGenerator string `json:"idGenerator"`
+	// admin created on the first start outside dev, where the admin and staff users of the data files are not
+	// loaded. The password is only read from the environment or the config file
+	AdminUsername string `json:"adminUsername"`
+	AdminPassword string `json:"adminPassword"`
+	// ip ranges of the proxies in front of the service, e.g. 10.0.0.0/8. The client ip is taken from the
+	// X-Forwarded-For header only for the requests coming through them, for the others it is the remote address
+	TrustedProxies []string `json:"trustedProxies"`
+	// keys signing the access tokens. An ephemeral key is generated when none is given, which only dev allows
+	SigningKeys []SigningKey `json:"signingKeys"`
+}
+
+// SigningKey is a private key for the access tokens. Keys are rotated by giving the next key a later ActiveFrom,
+// the previous key keeps verifying the tokens it signed until its RetireAt, which should be at least the access
+// token lifetime after the next key becomes active
+type SigningKey struct {
+	ID             string    `json:"id"`             // kid header of the tokens
+	Algorithm      string    `json:"algorithm"`      // RS256 or EdDSA
+	PrivateKeyFile string    `json:"privateKeyFile"` // PEM file, PKCS#8 or PKCS#1 for RSA
+	ActiveFrom     time.Time `json:"activeFrom"`
+	RetireAt       time.Time `json:"retireAt"` // optional
 }
 
 var once sync.Once
-var instance *Config
-var err error
+var instance atomic.Pointer[Config]
+var arguments []string // command line arguments given to Init, read again on every reload
 
+// GetConfig returns the current config. When Init was not called, the config is loaded without any flags
 func GetConfig() *Config {
+	if c := instance.Load(); c != nil {
+		return c
+	}
+
 	once.Do(func() {
-		instance, err = loadConfig("./internal/config/config.json")
+		_, err := Init(nil)
 		if err != nil {
 			logrus.Fatal(err)
 		}
 	})
 
-	return instance
+	return instance.Load()
 }
 
-func loadConfig(filePath string) (*Config, error) {
+// Init loads the config with the command line arguments, without the program name, and makes it the current one
+func Init(args []string) (*Config, error) {
+	c, err := Load(args)
+	if err != nil {
+		return nil, err
+	}
+
+	arguments = args
+	instance.Store(c)
+	return c, nil
+}
+
+// Reload loads the config again and applies the settings which are safe to change while the service runs, the
+// log level and the login limits. Changes to the other settings are left for the next start
+func Reload() (*Config, error) {
+	next, err := Load(arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	reloaded := *GetConfig()
+	reloaded.LogLevel = next.LogLevel
+	reloaded.LoginMaxAttempts = next.LoginMaxAttempts
+	reloaded.LoginMaxAttemptsPerIP = next.LoginMaxAttemptsPerIP
+	reloaded.LoginLockoutMinutes = next.LoginLockoutMinutes
+
+	if !reflect.DeepEqual(next, &reloaded) {
+		logrus.Warn("Settings which can not be reloaded have changed, they are applied on the next start")
+	}
+
+	instance.Store(&reloaded)
+	return &reloaded, nil
+}
+
+// Load builds the config from its layers, each overriding the ones before: the defaults, the config file, the
+// environment variables and the command line flags. The secret file is read last
+func Load(args []string) (*Config, error) {
+	path, explicit, flagValues, err := parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+
+	c := defaults()
+	err = c.readFile(path, explicit)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.readEnv(os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fv := range flagValues {
+		err = fv.setting.set(c, fv.value)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid value of the flag --%s : %s", fv.setting.name, err.Error()))
+		}
+	}
+
+	if c.SecretFile != "" {
+		secret, err := os.ReadFile(c.SecretFile)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to read the secret file : %s", err.Error()))
+		}
+		c.Secret = strings.TrimSpace(string(secret))
+	}
+
+	err = c.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func defaults() *Config {
+	return &Config{
+		Port:                  8080,
+		Name:                  "online_store",
+		Environment:           EnvironmentDev,
+		LogLevel:              logrus.InfoLevel.String(),
+		Secret:                defaultSecret,
+		DataFilePath:          "./internal/data/static",
+		Storage:               util.StorageMemory,
+		DatabasePath:          "./online_store.db",
+		Currency:              "USD",
+		PasswordCost:          10,
+		AccessTokenMinutes:    15,
+		RefreshTokenHours:     168,
+		LoginMaxAttempts:      5,
+		LoginMaxAttemptsPerIP: 50,
+		LoginLockoutMinutes:   15,
+		IDGenerator:           idgen.KindSequence,
+		AdminUsername:         "admin",
+	}
+}
+
+// readFile reads the settings of the config file over the defaults. The default file can be missing, a file
+// given by the flag can not
+func (c *Config) readFile(filePath string, explicit bool) error {
 	file, err := os.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		logrus.WithField("path", filePath).Info("No config file, using the defaults")
+		return nil
+	}
 	if err != nil {
 		logrus.WithError(err).Error("Failed to open config file")
-		return nil, err
+		return err
 	}
 	defer file.Close()
 
-	var config Config
-	err = json.NewDecoder(file).Decode(&config)
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(c)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to decode config")
-		return nil, err
+		return errors.New(fmt.Sprintf("Invalid config file %s : %s", filePath, err.Error()))
+	}
+
+	return nil
+}
+
+// Validate checks the settings together, the error lists every problem found
+func (c *Config) Validate() error {
+	problems := make([]string, 0)
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Port <= 0 || c.Port > 65535 {
+		add("port should be between 1 and 65535, got %d", c.Port)
+	}
+
+	if c.Environment != EnvironmentDev && c.Environment != EnvironmentProd {
+		add("environment should be %s or %s, got %q", EnvironmentDev, EnvironmentProd, c.Environment)
+	}
+
+	if _, err := logrus.ParseLevel(c.LogLevel); err != nil {
+		add("log level should be one of panic, fatal, error, warn, info, debug or trace, got %q", c.LogLevel)
+	}
+
+	switch {
+	case c.Secret == "":
+		add("secret is required, set ONLINE_STORE_SECRET or ONLINE_STORE_SECRET_FILE")
+	case c.Environment != EnvironmentDev && c.Secret == defaultSecret:
+		add("the default secret is only allowed in %s, set ONLINE_STORE_SECRET or ONLINE_STORE_SECRET_FILE",
+			EnvironmentDev)
+	case c.Environment != EnvironmentDev && len(c.Secret) < minSecretLength:
+		add("secret should be at least %d characters long outside %s", minSecretLength, EnvironmentDev)
+	}
+
+	if c.DataFilePath == "" {
+		add("data file path is required")
+	}
+
+	switch c.Storage {
+	case util.StorageMemory:
+	case util.StorageSQLite:
+		if c.DatabasePath == "" {
+			add("database path is required with the %s storage", util.StorageSQLite)
+		}
+	default:
+		add("storage should be %s or %s, got %q", util.StorageMemory, util.StorageSQLite, c.Storage)
+	}
+
+	if !money.IsSupportedCurrency(c.Currency) {
+		add("unsupported currency %q", c.Currency)
+	}
+
+	if !auth.IsValidPasswordCost(c.PasswordCost) {
+		add("invalid password cost %d", c.PasswordCost)
+	}
+
+	if c.AccessTokenMinutes <= 0 || c.RefreshTokenHours <= 0 {
+		add("token lifetimes should be greater than zero")
+	}
+
+	if c.LoginMaxAttempts <= 0 || c.LoginMaxAttemptsPerIP <= 0 || c.LoginLockoutMinutes <= 0 {
+		add("login attempt limits should be greater than zero")
+	}
+
+	if _, err := idgen.New(c.IDGenerator); err != nil {
+		add("id generator should be %s, %s or %s, got %q", idgen.KindSequence, idgen.KindULID, idgen.KindUUIDv7,
+			c.IDGenerator)
+	}
+
+	if c.AdminPassword != "" && (len(c.AdminPassword) < 8 || !auth.IsValidPasswordLength(c.AdminPassword)) {
+		add("admin password should be 8 to %d bytes long", auth.MaxPasswordBytes)
+	}
+
+	if c.AdminPassword != "" && c.AdminUsername == "" {
+		add("admin username is required with the admin password")
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil {
+			add("trusted proxy should be an ip range, e.g. 10.0.0.0/8, got %q", proxy)
+		}
+	}
+
+	if len(c.SigningKeys) == 0 && c.Environment != EnvironmentDev {
+		// the generated key lives in memory, the tokens would stop working on a restart and on the other replicas
+		add("signing keys are required outside %s", EnvironmentDev)
+	}
+
+	for i, key := range c.SigningKeys {
+		if key.ID == "" || key.PrivateKeyFile == "" {
+			add("signing key %d needs an id and a private key file", i+1)
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(fmt.Sprintf("Invalid config : %s", strings.Join(problems, "; ")))
 	}
 
-	return &config, nil
+	return nil
 }
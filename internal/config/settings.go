@@ -0,0 +1,174 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// envPrefix starts the names of the environment variables, e.g. ONLINE_STORE_PORT
+const envPrefix = "ONLINE_STORE_"
+
+// setting is a config value which can be given by an environment variable and a command line flag
+type setting struct {
+	name    string // flag name, the environment variable is the name in upper case with _ after the prefix
+	usage   string
+	secret  bool // not a flag, the command line can be seen by the other users of the host
+	boolean bool // a flag without a value sets it to true
+	set     func(c *Config, value string) error
+}
+
+var settings = []setting{
+	intSetting("port", "port the service listens on", func(c *Config) *int { return &c.Port }),
+	stringSetting("name", "name of the service", func(c *Config) *string { return &c.Name }),
+	stringSetting("environment", "dev or prod", func(c *Config) *string { return &c.Environment }),
+	stringSetting("log-level", "log level, e.g. info or debug", func(c *Config) *string { return &c.LogLevel }),
+	{name: "secret", secret: true, set: func(c *Config, value string) error {
+		c.Secret = value
+		return nil
+	}},
+	stringSetting("secret-file", "file holding the secret", func(c *Config) *string { return &c.SecretFile }),
+	stringSetting("data-file-path", "directory of the data files",
+		func(c *Config) *string { return &c.DataFilePath }),
+	stringSetting("storage", "memory or sqlite", func(c *Config) *string { return &c.Storage }),
+	stringSetting("database-path", "sqlite database file", func(c *Config) *string { return &c.DatabasePath }),
+	stringSetting("currency", "ISO 4217 code of the currency", func(c *Config) *string { return &c.Currency }),
+	intSetting("password-cost", "bcrypt cost of the passwords", func(c *Config) *int { return &c.PasswordCost }),
+	intSetting("access-token-minutes", "lifetime of the access tokens",
+		func(c *Config) *int { return &c.AccessTokenMinutes }),
+	intSetting("refresh-token-hours", "lifetime of a login session",
+		func(c *Config) *int { return &c.RefreshTokenHours }),
+	intSetting("login-max-attempts", "failed logins which lock a username",
+		func(c *Config) *int { return &c.LoginMaxAttempts }),
+	intSetting("login-max-attempts-per-ip", "failed logins which lock an ip",
+		func(c *Config) *int { return &c.LoginMaxAttemptsPerIP }),
+	intSetting("login-lockout-minutes", "how long the logins stay locked",
+		func(c *Config) *int { return &c.LoginLockoutMinutes }),
+	boolSetting("strict-data-load", "fail the startup on any invalid row of the data files",
+		func(c *Config) *bool { return &c.StrictDataLoad }),
+	stringSetting("id-generator", "sequence, ulid or uuidv7", func(c *Config) *string { return &c.IDGenerator }),
+	stringSetting("admin-username", "admin created on the first start outside dev",
+		func(c *Config) *string { return &c.AdminUsername }),
+	{name: "admin-password", secret: true, set: func(c *Config, value string) error {
+		c.AdminPassword = value
+		return nil
+	}},
+	listSetting("trusted-proxies", "comma separated ip ranges of the proxies in front of the service",
+		func(c *Config) *[]string { return &c.TrustedProxies }),
+}
+
+func stringSetting(name string, usage string, field func(c *Config) *string) setting {
+	return setting{name: name, usage: usage, set: func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}}
+}
+
+// listSetting reads a comma separated list, an empty value clears the list
+func listSetting(name string, usage string, field func(c *Config) *[]string) setting {
+	return setting{name: name, usage: usage, set: func(c *Config, value string) error {
+		values := make([]string, 0)
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+
+		*field(c) = values
+		return nil
+	}}
+}
+
+func intSetting(name string, usage string, field func(c *Config) *int) setting {
+	return setting{name: name, usage: usage, set: func(c *Config, value string) error {
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("should be a whole number")
+		}
+
+		*field(c) = number
+		return nil
+	}}
+}
+
+func boolSetting(name string, usage string, field func(c *Config) *bool) setting {
+	return setting{name: name, usage: usage, boolean: true, set: func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("should be true or false")
+		}
+
+		*field(c) = b
+		return nil
+	}}
+}
+
+func (s *setting) envName() string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(s.name, "-", "_"))
+}
+
+// readEnv reads the settings given by environment variables over the config file
+func (c *Config) readEnv(lookup func(key string) (string, bool)) error {
+	for _, s := range settings {
+		value, ok := lookup(s.envName())
+		if !ok {
+			continue
+		}
+
+		err := s.set(c, value)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Invalid value of the environment variable %s : %s", s.envName(),
+				err.Error()))
+		}
+	}
+
+	return nil
+}
+
+type flagValue struct {
+	setting *setting
+	value   string
+}
+
+// parseFlags returns the config file path, whether it was given, and the values of the setting flags in the
+// order they were given. The values are set after the environment variables are read
+func parseFlags(args []string) (string, bool, []flagValue, error) {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	path := fs.String("config", DefaultPath, "path of the config file")
+
+	values := make([]flagValue, 0)
+	for i := range settings {
+		s := &settings[i]
+		if s.secret {
+			continue
+		}
+
+		usage := fmt.Sprintf("%s, overrides %s", s.usage, s.envName())
+		collect := func(value string) error {
+			values = append(values, flagValue{setting: s, value: value})
+			return nil
+		}
+		if s.boolean {
+			fs.BoolFunc(s.name, usage, collect)
+		} else {
+			fs.Func(s.name, usage, collect)
+		}
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return "", false, nil, err
+	}
+
+	explicit := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "config" {
+			explicit = true
+		}
+	})
+
+	return *path, explicit, values, nil
+}
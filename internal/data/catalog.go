@@ -0,0 +1,295 @@
+package data
+
+import (
+	"OnlieStore/internal/model"
+	"OnlieStore/internal/money"
+	"OnlieStore/internal/util"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var ErrInvalidImport = errors.New("Import file can not be read")
+
+// maxImportRows keeps a single import small enough to be checked and saved in one go
+const maxImportRows = 10000
+
+// productRecord is a row as it is written in the files, the prices are decimal amounts in the store currency
+type productRecord struct {
+	ID           string            `json:"id,omitempty"`
+	SKU          string            `json:"sku,omitempty"`
+	Name         string            `json:"name"`
+	Price        string            `json:"price"`
+	Category     string            `json:"category"`
+	Quantity     int               `json:"quantity"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	VariantPrice string            `json:"variant_price,omitempty"`
+}
+
+// ReadProductRows reads the rows of a bulk import. Rows which can not be parsed are returned as issues and
+// left out, the error is for a file which can not be read at all
+func (l *Loader) ReadProductRows(r io.Reader, format string) ([]*model.ProductRow, []*model.ImportIssue, error) {
+	var rows []*model.ProductRow
+	var issues []*model.ImportIssue
+	var err error
+	switch format {
+	case util.FormatCSV:
+		rows, issues, err = l.readCSVRows(r)
+	case util.FormatJSON:
+		rows, issues, err = l.readJSONRows(r)
+	default:
+		err = errors.New(fmt.Sprintf("Unsupported format : %s", format))
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w, %s", ErrInvalidImport, err.Error())
+	}
+
+	return rows, issues, nil
+}
+
+func (l *Loader) readCSVRows(r io.Reader) ([]*model.ProductRow, []*model.ImportIssue, error) {
+	records, issues, err := readCSV(r, catalogSchema, maxImportRows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows := make([]*model.ProductRow, 0, len(records))
+	for _, rec := range records {
+		attributes, err := parseAttributes(rec.get("attributes"))
+		if err != nil {
+			issues = append(issues, rec.issue("attributes", err.Error()))
+			continue
+		}
+
+		row, issue := l.parseCatalogRecord(rec.line, &productRecord{
+			ID:           rec.get("id"),
+			SKU:          rec.get("sku"),
+			Name:         rec.get("name"),
+			Price:        rec.get("price"),
+			Category:     rec.get("category"),
+			Quantity:     rec.getInt("quantity"),
+			Attributes:   attributes,
+			VariantPrice: rec.get("variant_price"),
+		})
+		if issue != nil {
+			issues = append(issues, issue)
+			continue
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, issues, nil
+}
+
+func (l *Loader) readJSONRows(r io.Reader) ([]*model.ProductRow, []*model.ImportIssue, error) {
+	scanner := bufio.NewScanner(r)
+	rows := make([]*model.ProductRow, 0)
+	issues := make([]*model.ImportIssue, 0)
+	count := 0
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		count++
+		if count > maxImportRows {
+			return nil, nil, errors.New(fmt.Sprintf("Too many rows, at most %d rows can be imported at once",
+				maxImportRows))
+		}
+
+		record := &productRecord{}
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(record)
+		if err != nil {
+			issues = append(issues, &model.ImportIssue{Row: line, Reason: err.Error()})
+			continue
+		}
+
+		row, issue := l.parseCatalogRecord(line, record)
+		if issue != nil {
+			issues = append(issues, issue)
+			continue
+		}
+
+		rows = append(rows, row)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return rows, issues, nil
+}
+
+// parseCatalogRecord checks the fields of a row, the same way the add product request is checked
+func (l *Loader) parseCatalogRecord(line int, record *productRecord) (*model.ProductRow, *model.ImportIssue) {
+	issue := func(field string, reason string) *model.ImportIssue {
+		return &model.ImportIssue{Row: line, Field: field, Reason: reason}
+	}
+
+	// lengths are in characters, the same as the max rule of the validator
+	if n := utf8.RuneCountInString(record.Name); n < 5 || n > 15 {
+		return nil, issue("name", "Name should be 5 to 15 characters long")
+	}
+
+	if record.Category == "" {
+		return nil, issue("category", "Category is required")
+	}
+
+	if record.Quantity < 0 {
+		return nil, issue("quantity", fmt.Sprintf("Invalid quantity : %d", record.Quantity))
+	}
+
+	price, err := money.Parse(record.Price, l.currency)
+	if err != nil {
+		return nil, issue("price", err.Error())
+	}
+	if !price.IsPositive() {
+		return nil, issue("price", "Price should be greater than zero")
+	}
+
+	row := &model.ProductRow{
+		Row:      line,
+		ID:       record.ID,
+		SKU:      record.SKU,
+		Name:     record.Name,
+		Price:    price,
+		Category: record.Category,
+		Quantity: record.Quantity,
+	}
+
+	if record.SKU == "" {
+		if len(record.Attributes) > 0 || record.VariantPrice != "" {
+			return nil, issue("sku", "SKU is required for a variant")
+		}
+		return row, nil
+	}
+
+	if utf8.RuneCountInString(record.SKU) > 32 {
+		return nil, issue("sku", "SKU should be at most 32 characters long")
+	}
+
+	if len(record.Attributes) == 0 {
+		return nil, issue("attributes", "Attributes are required for a variant")
+	}
+	row.Attributes = record.Attributes
+
+	if record.VariantPrice != "" {
+		variantPrice, err := money.Parse(record.VariantPrice, l.currency)
+		if err != nil {
+			return nil, issue("variant_price", err.Error())
+		}
+		if !variantPrice.IsPositive() {
+			return nil, issue("variant_price", "Price should be greater than zero")
+		}
+		row.VariantPrice = &variantPrice
+	}
+
+	return row, nil
+}
+
+// WriteProductRows writes the rows of an export, in a form ReadProductRows reads back
+func WriteProductRows(w io.Writer, format string, rows []*model.ProductRow) error {
+	switch format {
+	case util.FormatCSV:
+		writer := csv.NewWriter(w)
+		err := writer.Write(catalogSchema.columnNames())
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			r := newProductRecord(row)
+			err = writer.Write([]string{r.ID, r.SKU, r.Name, r.Price, r.Category, strconv.Itoa(r.Quantity),
+				formatAttributes(r.Attributes), r.VariantPrice})
+			if err != nil {
+				return err
+			}
+		}
+
+		writer.Flush()
+		return writer.Error()
+	case util.FormatJSON:
+		encoder := json.NewEncoder(w)
+		for _, row := range rows {
+			err := encoder.Encode(newProductRecord(row))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	default:
+		return errors.New(fmt.Sprintf("Unsupported format : %s", format))
+	}
+}
+
+func newProductRecord(row *model.ProductRow) *productRecord {
+	r := &productRecord{
+		ID:         row.ID,
+		SKU:        row.SKU,
+		Name:       row.Name,
+		Price:      row.Price.String(),
+		Category:   row.Category,
+		Quantity:   row.Quantity,
+		Attributes: row.Attributes,
+	}
+
+	if row.VariantPrice != nil {
+		r.VariantPrice = row.VariantPrice.String()
+	}
+
+	return r
+}
+
+// parseAttributes reads the attributes of a variant written as "colour=red;size=M"
+func parseAttributes(value string) (map[string]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	result := make(map[string]string)
+	for _, pair := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(pair, "=")
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+		if !ok || key == "" || val == "" {
+			return nil, errors.New(fmt.Sprintf("Invalid attribute : %s, should be name=value", pair))
+		}
+
+		result[key] = val
+	}
+
+	return result, nil
+}
+
+// formatAttributes writes the attributes sorted by name, so that an export is the same every time
+func formatAttributes(attributes map[string]string) string {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+attributes[key])
+	}
+
+	return strings.Join(pairs, ";")
+}
+
+// IsCatalogFormat tells whether the format can be imported and exported
+func IsCatalogFormat(format string) bool {
+	return format == util.FormatCSV || format == util.FormatJSON
+}
@@ -1,113 +1,165 @@
 package data
 
 import (
+	"OnlieStore/internal/auth"
 	"OnlieStore/internal/model"
-	"bufio"
-	"encoding/csv"
-	"github.com/sirupsen/logrus"
-	"io"
+	"OnlieStore/internal/money"
+	"OnlieStore/internal/util"
+	"fmt"
 	"os"
-	"strconv"
 )
 
-type Loader struct{}
-
-func NewLoader() *Loader {
-	return &Loader{}
+type Loader struct {
+	currency     string // currency of the prices in the files
+	passwordCost int    // bcrypt cost used to hash the plaintext passwords in the files
 }
 
-func (l *Loader) LoadUsers(filePath string) ([]*model.User, error) {
-	result := make([]*model.User, 0)
-	f, err := os.Open(filePath)
-	if err != nil {
-		return result, err
+func NewLoader(currency string, passwordCost int) *Loader {
+	return &Loader{
+		currency:     currency,
+		passwordCost: passwordCost,
 	}
-	defer f.Close()
+}
 
-	reader := csv.NewReader(bufio.NewReader(f))
-	_, err = reader.Read() // header row
+// LoadUsers reads the users file. Rows which can not be read are returned as issues and left out
+func (l *Loader) LoadUsers(filePath string) ([]*model.User, []*model.ImportIssue, error) {
+	records, issues, err := readCSVFile(filePath, userSchema)
 	if err != nil {
-		return result, err
+		return nil, nil, err
 	}
 
-	for {
-		line, err := reader.Read()
-		if err == io.EOF {
-			break
+	ids := newIDColumn("user_id")
+	result := make([]*model.User, 0, len(records))
+	for _, rec := range records {
+		u, issue := parseUserRecord(rec, l.passwordCost)
+		if issue == nil {
+			issue = ids.check(rec)
 		}
-
-		if err != nil {
-			logrus.WithError(err).Error("Read line failed")
+		if issue != nil {
+			issues = append(issues, issue)
 			continue
 		}
 
-		u := parseUserRow(line)
 		result = append(result, u)
 	}
 
-	return result, nil
+	sortIssues(issues)
+	return result, issues, nil
 }
 
-func (l *Loader) LoadProducts(filePath string) ([]*model.ProductDetails, error) {
-	result := make([]*model.ProductDetails, 0)
-	f, err := os.Open(filePath)
-	if err != nil {
-		return result, err
-	}
-	defer f.Close()
-
-	reader := csv.NewReader(bufio.NewReader(f))
-	_, err = reader.Read() // header row
+// LoadProducts reads the products file. Rows which can not be read are returned as issues and left out
+func (l *Loader) LoadProducts(filePath string) ([]*model.ProductDetails, []*model.ImportIssue, error) {
+	records, issues, err := readCSVFile(filePath, productSchema)
 	if err != nil {
-		return result, err
+		return nil, nil, err
 	}
 
-	for {
-		line, err := reader.Read()
-		if err == io.EOF {
-			break
+	ids := newIDColumn("id")
+	result := make([]*model.ProductDetails, 0, len(records))
+	for _, rec := range records {
+		p, issue := parseProductRecord(rec, l.currency)
+		if issue == nil {
+			issue = ids.check(rec)
 		}
-
-		if err != nil {
-			logrus.WithError(err).Error("Read line failed")
+		if issue != nil {
+			issues = append(issues, issue)
 			continue
 		}
 
-		p, err := parseProductRow(line)
-		if err != nil {
-			logrus.WithError(err).Error("Parse product row failed")
+		result = append(result, p)
+	}
+
+	sortIssues(issues)
+	return result, issues, nil
+}
+
+// LoadCategories reads the categories with the slug of their parent, parents have to come before their children
+func (l *Loader) LoadCategories(filePath string) ([]*model.CategoryDetails, []*model.ImportIssue, error) {
+	records, issues, err := readCSVFile(filePath, categorySchema)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids := newIDColumn("id")
+	result := make([]*model.CategoryDetails, 0, len(records))
+	for _, rec := range records {
+		if issue := ids.check(rec); issue != nil {
+			issues = append(issues, issue)
 			continue
 		}
 
-		result = append(result, p)
+		result = append(result, &model.CategoryDetails{
+			ID:     rec.get("id"),
+			Slug:   rec.get("slug"),
+			Name:   rec.get("name"),
+			Parent: rec.get("parent"),
+		})
 	}
 
-	return result, nil
+	sortIssues(issues)
+	return result, issues, nil
 }
 
-func parseUserRow(row []string) *model.User {
-	return &model.User{
-		ID:       row[0],
-		Name:     row[1],
-		Password: row[2],
+func readCSVFile(filePath string, schema *Schema) ([]*record, []*model.ImportIssue, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, err
 	}
+	defer f.Close()
+
+	return readCSV(f, schema, 0)
 }
 
-func parseProductRow(row []string) (*model.ProductDetails, error) {
-	price, err := strconv.ParseFloat(row[1], 64)
-	if err != nil {
-		return nil, err
+// parseUserRecord accepts either a bcrypt hash or a plaintext password, plaintext is hashed on import.
+// Users without a role are customers
+func parseUserRecord(rec *record, passwordCost int) (*model.User, *model.ImportIssue) {
+	role := rec.get("role")
+	if role == "" {
+		role = util.RoleCustomer
+	}
+
+	if !util.IsValidRole(role) {
+		return nil, rec.issue("role", fmt.Sprintf("Invalid role : %s", role))
+	}
+
+	hash := rec.get("password")
+	if !auth.IsPasswordHash(hash) {
+		var err error
+		hash, err = auth.HashPassword(hash, passwordCost)
+		if err != nil {
+			return nil, rec.issue("password", err.Error())
+		}
 	}
 
-	qty, err := strconv.Atoi(row[3])
+	return &model.User{
+		ID:           rec.get("user_id"),
+		Name:         rec.get("user_name"),
+		Role:         role,
+		PasswordHash: hash,
+		Addresses:    []*model.Address{},
+	}, nil
+}
+
+func parseProductRecord(rec *record, currency string) (*model.ProductDetails, *model.ImportIssue) {
+	price, err := money.Parse(rec.get("price"), currency)
 	if err != nil {
-		return nil, err
+		return nil, rec.issue("price", err.Error())
+	}
+
+	if !price.IsPositive() {
+		return nil, rec.issue("price", fmt.Sprintf("Invalid price : %s", rec.get("price")))
+	}
+
+	qty := rec.getInt("addedQuantity")
+	if qty < 0 {
+		return nil, rec.issue("addedQuantity", fmt.Sprintf("Invalid quantity : %d", qty))
 	}
 
 	return &model.ProductDetails{
-		Name:          row[0],
+		ID:            rec.get("id"),
+		Name:          rec.get("name"),
 		Price:         price,
-		Category:      row[2],
+		Category:      rec.get("category"),
 		AddedQuantity: qty,
 	}, nil
 }
@@ -0,0 +1,246 @@
+package data
+
+import (
+	"OnlieStore/internal/idgen"
+	"OnlieStore/internal/model"
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ColumnType is what the values of a column are checked against
+type ColumnType int
+
+const (
+	ColumnText    ColumnType = iota
+	ColumnInteger            // whole number, can be negative
+	ColumnDecimal            // decimal amount such as 19.99
+)
+
+var decimalPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// Column is a column of a csv file, matched by its name in the header row regardless of the case
+type Column struct {
+	Name     string
+	Type     ColumnType
+	Required bool // a required column has to be in the header and has to have a value on every row
+}
+
+// Schema lists the columns of the csv file of an entity. Columns can come in any order, optional columns can be
+// left out and columns which are not in the schema are ignored
+type Schema struct {
+	Entity  string
+	Columns []Column
+}
+
+var userSchema = &Schema{
+	Entity: "user",
+	Columns: []Column{
+		{Name: "user_id", Type: ColumnText}, // generated when empty
+		{Name: "user_name", Type: ColumnText, Required: true},
+		{Name: "password", Type: ColumnText, Required: true}, // bcrypt hash or plaintext
+		{Name: "role", Type: ColumnText},                     // customer when empty
+	},
+}
+
+var productSchema = &Schema{
+	Entity: "product",
+	Columns: []Column{
+		{Name: "id", Type: ColumnText}, // generated when empty
+		{Name: "name", Type: ColumnText, Required: true},
+		{Name: "price", Type: ColumnDecimal, Required: true},
+		{Name: "category", Type: ColumnText, Required: true},
+		{Name: "addedQuantity", Type: ColumnInteger, Required: true},
+	},
+}
+
+var categorySchema = &Schema{
+	Entity: "category",
+	Columns: []Column{
+		{Name: "id", Type: ColumnText}, // generated when empty
+		{Name: "slug", Type: ColumnText, Required: true},
+		{Name: "name", Type: ColumnText, Required: true},
+		{Name: "parent", Type: ColumnText}, // slug of the parent, empty for a top level category
+	},
+}
+
+// catalogSchema is the schema of the bulk product import, the columns are exported in this order
+var catalogSchema = &Schema{
+	Entity: "product",
+	Columns: []Column{
+		{Name: "id", Type: ColumnText},
+		{Name: "sku", Type: ColumnText},
+		{Name: "name", Type: ColumnText, Required: true},
+		{Name: "price", Type: ColumnDecimal, Required: true},
+		{Name: "category", Type: ColumnText, Required: true},
+		{Name: "quantity", Type: ColumnInteger, Required: true},
+		{Name: "attributes", Type: ColumnText}, // name=value pairs separated by ";"
+		{Name: "variant_price", Type: ColumnDecimal},
+	},
+}
+
+func (s *Schema) columnNames() []string {
+	result := make([]string, 0, len(s.Columns))
+	for _, c := range s.Columns {
+		result = append(result, c.Name)
+	}
+
+	return result
+}
+
+// record is a row of a csv file which matches its schema
+type record struct {
+	line   int
+	values map[string]string // key - lower case column name, empty for the optional columns left out
+}
+
+func (r *record) get(name string) string {
+	return r.values[strings.ToLower(name)]
+}
+
+// getInt returns the value of an integer column, 0 when it is empty
+func (r *record) getInt(name string) int {
+	value, _ := strconv.Atoi(r.get(name))
+	return value
+}
+
+// issue is a problem with a value of the record, found after the schema was checked
+func (r *record) issue(column string, reason string) *model.ImportIssue {
+	return &model.ImportIssue{Row: r.line, Field: column, Reason: reason}
+}
+
+// idColumn checks the ids given in a data file, the ids are optional but have to be unique in the file
+type idColumn struct {
+	name string
+	rows map[string]int // key - id, value - row of the id
+}
+
+func newIDColumn(name string) *idColumn {
+	return &idColumn{name: name, rows: make(map[string]int)}
+}
+
+func (c *idColumn) check(rec *record) *model.ImportIssue {
+	id := rec.get(c.name)
+	if id == "" {
+		return nil
+	}
+
+	err := idgen.Validate(id)
+	if err != nil {
+		return rec.issue(c.name, err.Error())
+	}
+
+	if first, ok := c.rows[id]; ok {
+		return rec.issue(c.name, fmt.Sprintf("Id %s is already on row %d", id, first))
+	}
+	c.rows[id] = rec.line
+
+	return nil
+}
+
+// readCSV reads the rows of a csv file and checks them against the schema. Rows which do not match are returned
+// as issues, the error is for a file which can not be read, e.g. when a required column is missing. maxRows is
+// the most rows the file can have, 0 for any number
+func readCSV(r io.Reader, schema *Schema, maxRows int) ([]*record, []*model.ImportIssue, error) {
+	reader := csv.NewReader(bufio.NewReader(r))
+	reader.FieldsPerRecord = -1 // short rows are reported by the schema check
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("Failed to read the header row of the %s file : %s", schema.Entity,
+			err.Error()))
+	}
+
+	positions := make(map[string]int) // key - lower case column name, value - position in the row
+	for i, name := range header {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if _, ok := positions[key]; ok {
+			return nil, nil, errors.New(fmt.Sprintf("Duplicate column %s in the %s file", name, schema.Entity))
+		}
+		positions[key] = i
+	}
+
+	for _, c := range schema.Columns {
+		if _, ok := positions[strings.ToLower(c.Name)]; !ok && c.Required {
+			return nil, nil, errors.New(fmt.Sprintf("Missing column %s in the %s file", c.Name, schema.Entity))
+		}
+	}
+
+	records := make([]*record, 0)
+	issues := make([]*model.ImportIssue, 0)
+	for count := 1; ; count++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if maxRows > 0 && count > maxRows {
+			return nil, nil, errors.New(fmt.Sprintf("Too many rows, at most %d rows can be read at once", maxRows))
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			issues = append(issues, &model.ImportIssue{Row: parseErr.StartLine, Reason: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// quoted values can span lines, so the line of a row is not always its row number plus one
+		line, _ := reader.FieldPos(0)
+		rec, issue := schema.check(line, fields, positions)
+		if issue != nil {
+			issues = append(issues, issue)
+			continue
+		}
+
+		records = append(records, rec)
+	}
+
+	return records, issues, nil
+}
+
+// check makes a record of the row, when the row has the required values and the values have the right types
+func (s *Schema) check(line int, fields []string, positions map[string]int) (*record, *model.ImportIssue) {
+	rec := &record{line: line, values: make(map[string]string, len(s.Columns))}
+	for _, c := range s.Columns {
+		key := strings.ToLower(c.Name)
+		value := ""
+		if i, ok := positions[key]; ok && i < len(fields) {
+			value = strings.TrimSpace(fields[i])
+		}
+
+		if value == "" {
+			if c.Required {
+				return nil, rec.issue(c.Name, "Value is required")
+			}
+			continue
+		}
+
+		switch c.Type {
+		case ColumnInteger:
+			if _, err := strconv.Atoi(value); err != nil {
+				return nil, rec.issue(c.Name, fmt.Sprintf("Invalid integer : %s", value))
+			}
+		case ColumnDecimal:
+			if !decimalPattern.MatchString(value) {
+				return nil, rec.issue(c.Name, fmt.Sprintf("Invalid decimal : %s", value))
+			}
+		}
+
+		rec.values[key] = value
+	}
+
+	return rec, nil
+}
+
+// sortIssues puts the issues in the order of the rows, the issues of the values are found after the schema check
+func sortIssues(issues []*model.ImportIssue) {
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Row < issues[j].Row })
+}
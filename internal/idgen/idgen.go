@@ -0,0 +1,221 @@
+package idgen
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidID = errors.New("Invalid id, use at most 40 letters, digits, - and _")
+var ErrIDExists = errors.New("Id is already used")
+
+// kinds of generators, chosen in the config
+const (
+	KindSequence = "sequence"
+	KindULID     = "ulid"
+	KindUUIDv7   = "uuidv7"
+)
+
+// defaultWidth is the digits of a sequence id when no id with the prefix was seen, e.g. P00001
+const defaultWidth = 5
+
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,40}$`)
+
+// Generator makes the ids of the entities, an id is the prefix of the entity followed by a value which sorts in
+// the order the ids were made. The services check the ids against the ids they hold, a generator only has to
+// avoid the ids it made and the ids it was told about
+type Generator interface {
+	NewID(prefix string) string
+	// Observe tells the generator about an id in use, e.g. one loaded from the repository
+	Observe(prefix string, id string)
+}
+
+// New returns the generator of the kind, the sequence generator when the kind is empty
+func New(kind string) (Generator, error) {
+	switch kind {
+	case "", KindSequence:
+		return NewSequence(), nil
+	case KindULID:
+		return NewULID(), nil
+	case KindUUIDv7:
+		return NewUUIDv7(), nil
+	default:
+		return nil, errors.New(fmt.Sprintf("Unsupported id generator : %s", kind))
+	}
+}
+
+// Compare orders the ids by the time they were made, shorter ids first and ids of the same length as text. A
+// sequence id which outgrew its zero padding, e.g. P100000, comes after the padded ones, and the ulid and uuidv7
+// ids, which all have the same length, come after the sequence ids they replaced
+func Compare(a string, b string) int {
+	if len(a) != len(b) {
+		return cmp.Compare(len(a), len(b))
+	}
+
+	return strings.Compare(a, b)
+}
+
+// Validate checks an id given from outside, e.g. by a data file
+func Validate(id string) error {
+	if !idPattern.MatchString(id) {
+		return fmt.Errorf("%w, id: %s", ErrInvalidID, id)
+	}
+
+	return nil
+}
+
+// Sequence makes ids which count up per prefix, zero padded to the width of the ids already seen. Ids past the
+// width get longer, so they are ordered with Compare rather than as text. It continues after the largest id it
+// observed, so the ids stay the same across restarts and do not collide with the loaded ones
+type Sequence struct {
+	mu    sync.Mutex
+	last  map[string]int // key - prefix, value - largest number used with the prefix
+	width map[string]int // key - prefix, value - digits of the widest id observed with the prefix
+}
+
+func NewSequence() *Sequence {
+	return &Sequence{
+		last:  make(map[string]int),
+		width: make(map[string]int),
+	}
+}
+
+func (s *Sequence) NewID(prefix string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	width, ok := s.width[prefix]
+	if !ok {
+		width = defaultWidth
+	}
+
+	s.last[prefix]++
+	return fmt.Sprintf("%s%0*d", prefix, width, s.last[prefix])
+}
+
+// Observe ignores the ids which are not the prefix followed by a number, they can not collide with its ids
+func (s *Sequence) Observe(prefix string, id string) {
+	digits, ok := strings.CutPrefix(id, prefix)
+	if !ok || digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return
+	}
+
+	number, err := strconv.Atoi(digits)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.last[prefix] = max(s.last[prefix], number)
+	s.width[prefix] = max(s.width[prefix], len(digits))
+}
+
+// crockford is the alphabet of the ULIDs, without I, L, O and U
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID makes ids of 26 characters, 48 bits of milliseconds and 80 random bits. The ids made in the same
+// millisecond add one to the random bits of the previous id, so they sort in the order they were made
+type ULID struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	lastMs  uint64
+	lastHi  uint16 // top 16 of the random bits
+	lastLow uint64 // bottom 64 of the random bits
+}
+
+func NewULID() *ULID {
+	return &ULID{now: time.Now}
+}
+
+func (u *ULID) NewID(prefix string) string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	ms := uint64(u.now().UnixMilli())
+	if ms <= u.lastMs {
+		// same millisecond, or the clock went back
+		u.lastLow++
+		if u.lastLow == 0 {
+			u.lastHi++
+		}
+		if u.lastLow == 0 && u.lastHi == 0 {
+			// the random bits ran out, which moves on to the next millisecond
+			u.lastMs++
+		}
+	} else {
+		var random [10]byte
+		_, _ = rand.Read(random[:])
+		u.lastMs = ms
+		u.lastHi = binary.BigEndian.Uint16(random[:2])
+		u.lastLow = binary.BigEndian.Uint64(random[2:])
+	}
+
+	// 128 bits as two halves, written 5 bits at a time from the end
+	hi := u.lastMs<<16 | uint64(u.lastHi)
+	low := u.lastLow
+	var text [26]byte
+	for i := len(text) - 1; i >= 0; i-- {
+		text[i] = crockford[low&31]
+		low = low>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return prefix + string(text[:])
+}
+
+// Observe does nothing, the ids are made from the time and random bits
+func (u *ULID) Observe(string, string) {}
+
+// UUIDv7 makes version 7 UUIDs, 48 bits of milliseconds followed by random bits. The 12 bits after the version
+// count the ids made in the same millisecond, so they sort in the order they were made
+type UUIDv7 struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	lastMs  uint64
+	counter uint16
+}
+
+func NewUUIDv7() *UUIDv7 {
+	return &UUIDv7{now: time.Now}
+}
+
+func (u *UUIDv7) NewID(prefix string) string {
+	var random [10]byte
+	_, _ = rand.Read(random[:])
+
+	u.mu.Lock()
+	ms := uint64(u.now().UnixMilli())
+	if ms <= u.lastMs {
+		u.counter++
+		if u.counter > 0xfff {
+			u.lastMs++
+			u.counter = 0
+		}
+	} else {
+		u.lastMs = ms
+		u.counter = binary.BigEndian.Uint16(random[:2]) & 0x3ff // leaves room to count up
+	}
+	ms, counter := u.lastMs, u.counter
+	u.mu.Unlock()
+
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], ms<<16|0x7000|uint64(counter))
+	copy(b[8:], random[2:])
+	b[8] = b[8]&0x3f | 0x80 // variant 10
+
+	h := hex.EncodeToString(b[:])
+	return prefix + h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// Observe does nothing, the ids are made from the time and random bits
+func (u *UUIDv7) Observe(string, string) {}
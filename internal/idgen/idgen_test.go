@@ -0,0 +1,47 @@
+package idgen
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSequenceOrderPastWidth(t *testing.T) {
+	s := NewSequence()
+	s.Observe("P", "P99998")
+
+	ids := []string{"P99998"}
+	for i := 0; i < 3; i++ {
+		ids = append(ids, s.NewID("P"))
+	}
+
+	want := []string{"P99998", "P99999", "P100000", "P100001"}
+	if !slices.Equal(ids, want) {
+		t.Fatalf("ids = %v, want %v", ids, want)
+	}
+
+	shuffled := []string{"P100001", "P99999", "P100000", "P99998"}
+	slices.SortFunc(shuffled, Compare)
+	if !slices.Equal(shuffled, want) {
+		t.Errorf("sorted ids = %v, want %v", shuffled, want)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{a: "P00001", b: "P00002", want: -1},
+		{a: "P99999", b: "P100000", want: -1},
+		{a: "P100000", b: "P99999", want: 1},
+		{a: "P00001", b: "P00001", want: 0},
+		{a: "P99999", b: "P01JAXG5Z6Y1V7Q8H3K2M4N5P6R", want: -1}, // a ulid replacing the sequence
+	}
+
+	for _, tt := range tests {
+		if got := Compare(tt.a, tt.b); got != tt.want {
+			t.Errorf("Compare(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// OrderCounter is implemented by the order service
+type OrderCounter interface {
+	CountOrdersByStatus() map[string]int // key - order status, value - number of orders
+}
+
+// StockReader is implemented by the product store
+type StockReader interface {
+	GetStockLevels() map[string]int // key - product id, value - current quantity
+}
+
+// BusinessCollector reads the order and stock figures from the services on every scrape
+type BusinessCollector struct {
+	orders     OrderCounter
+	stock      StockReader
+	ordersDesc *prometheus.Desc
+	stockDesc  *prometheus.Desc
+}
+
+func NewBusinessCollector(orders OrderCounter, stock StockReader) *BusinessCollector {
+	return &BusinessCollector{
+		orders: orders,
+		stock:  stock,
+		ordersDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "orders"),
+			"Number of orders by status.",
+			[]string{"status"}, nil),
+		stockDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "product_stock"),
+			"Current quantity of a product in the store.",
+			[]string{"product_id"}, nil),
+	}
+}
+
+func (bc *BusinessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- bc.ordersDesc
+	ch <- bc.stockDesc
+}
+
+func (bc *BusinessCollector) Collect(ch chan<- prometheus.Metric) {
+	for status, count := range bc.orders.CountOrdersByStatus() {
+		ch <- prometheus.MustNewConstMetric(bc.ordersDesc, prometheus.GaugeValue, float64(count), status)
+	}
+
+	for productID, quantity := range bc.stock.GetStockLevels() {
+		ch <- prometheus.MustNewConstMetric(bc.stockDesc, prometheus.GaugeValue, float64(quantity), productID)
+	}
+}
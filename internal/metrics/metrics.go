@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "online_store"
+
+type Metrics struct {
+	registry        *prometheus.Registry
+	requestCount    *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	loginCount      *prometheus.CounterVec
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requestCount: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by method, route and status code.",
+		}, []string{"method", "route", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by method and route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		loginCount: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Number of login attempts by result.",
+		}, []string{"result"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requestCount,
+		m.requestDuration,
+		m.loginCount,
+	)
+
+	return m
+}
+
+// Register adds a collector, used by the services to expose their business metrics
+func (m *Metrics) Register(c prometheus.Collector) error {
+	return m.registry.Register(c)
+}
+
+// Handler serves the metrics in the prometheus text exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counts the requests and measures their latency per route
+func (m *Metrics) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			// use the route template instead of the raw path to keep the label values bounded
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+
+			code := c.Response().Status
+			if err != nil {
+				code = http.StatusInternalServerError
+				if he, ok := err.(*echo.HTTPError); ok {
+					code = he.Code
+				}
+			}
+
+			method := c.Request().Method
+			m.requestCount.WithLabelValues(method, route, strconv.Itoa(code)).Inc()
+			m.requestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+func (m *Metrics) LoginSucceeded() {
+	m.loginCount.WithLabelValues("success").Inc()
+}
+
+func (m *Metrics) LoginFailed() {
+	m.loginCount.WithLabelValues("failure").Inc()
+}
+
+func (m *Metrics) LoginThrottled() {
+	m.loginCount.WithLabelValues("throttled").Inc()
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+type Cart struct {
+	UserID    string      `json:"user_id"`
+	Items     []*CartItem `json:"items"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+type CartItem struct {
+	ProductID string `json:"product_id"`
+	SKU       string `json:"sku,omitempty"` // variant of the product, empty for products without variants
+	Quantity  int    `json:"quantity"`
+}
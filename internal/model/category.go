@@ -0,0 +1,24 @@
+package model
+
+// Category groups the products, a category can have sub categories
+type Category struct {
+	ID       string `json:"id"`
+	Slug     string `json:"slug"` // unique, lower case words joined by "-", e.g. home-decor
+	Name     string `json:"name"`
+	ParentID string `json:"parent_id,omitempty"` // empty for the top level categories
+}
+
+// CategoryDetails used when a new category is added
+type CategoryDetails struct {
+	ID     string // optional, generated when empty
+	Slug   string // optional, made from the name when empty
+	Name   string
+	Parent string // id, slug or name of the parent, empty for a top level category
+}
+
+// CategoryNode is a category in the category tree
+type CategoryNode struct {
+	*Category
+	ProductCount int             `json:"product_count"` // products in the category and its sub categories
+	Children     []*CategoryNode `json:"children"`
+}
@@ -0,0 +1,38 @@
+package model
+
+import "OnlieStore/internal/money"
+
+// ProductRow is a line of a bulk import or export. A product without variants takes one row, a product with
+// variants takes a row per variant, with the fields of the product repeated on each of them
+type ProductRow struct {
+	Row          int               // line number in the file, 0 for exported rows
+	ID           string            // product id, empty for a new product
+	SKU          string            // variant sku, empty for a product without variants
+	Name         string            // product name
+	Price        money.Money       // product price
+	Category     string            // id, slug or name of the category
+	Quantity     int               // current quantity of the product, or of the variant
+	Attributes   map[string]string // variant attributes
+	VariantPrice *money.Money      // price of the variant, nil when it sells at the price of the product
+}
+
+// ImportIssue is a reason a row of an import was refused
+type ImportIssue struct {
+	Row    int    `json:"row"`
+	Field  string `json:"field,omitempty"` // empty when the issue is with the whole row
+	Reason string `json:"reason"`
+}
+
+// ImportReport tells what an import did, or would do on a dry run. Nothing is imported when there are errors
+type ImportReport struct {
+	DryRun    bool           `json:"dry_run"`
+	Rows      int            `json:"rows"`
+	Created   int            `json:"created"` // rows which add a product or a variant
+	Updated   int            `json:"updated"`
+	Unchanged int            `json:"unchanged"`
+	Errors    []*ImportIssue `json:"errors"`
+}
+
+func (r *ImportReport) AddIssue(row int, field string, reason string) {
+	r.Errors = append(r.Errors, &ImportIssue{Row: row, Field: field, Reason: reason})
+}
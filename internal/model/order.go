@@ -1,24 +1,94 @@
 package model
 
 import (
+	"OnlieStore/internal/money"
 	"OnlieStore/internal/util"
 	"errors"
+	"fmt"
+	"time"
 )
 
+var ErrInvalidStatusTransition = errors.New("Invalid order status transition")
+
 type Order struct {
-	ID        string  `json:"id"`
-	UserID    string  `json:"user_id"`
-	Quantity  int     `json:"quantity"`
-	Price     float64 `json:"price"`
-	ProductID string  `json:"product_id"`
-	Status    string  `json:"status"`
+	ID        string               `json:"id"`
+	UserID    string               `json:"user_id"`
+	Items     []*OrderItem         `json:"items"`
+	Total     money.Money          `json:"total"`
+	Status    string               `json:"status"`
+	CreatedAt time.Time            `json:"created_at"`
+	History   []*OrderStatusChange `json:"history"` // status changes, oldest first
+}
+
+// OrderItem is a single line of an order
+type OrderItem struct {
+	ProductID     string       `json:"product_id"`
+	SKU           string       `json:"sku,omitempty"` // variant of the product, empty for products without variants
+	Quantity      int          `json:"quantity"`
+	Price         money.Money  `json:"price"` // unit price taken from the catalog when the order is placed
+	ExpectedPrice *money.Money `json:"-"`     // unit price seen by the client, the order is refused when it differs
+}
+
+func (item *OrderItem) Subtotal() (money.Money, error) {
+	return item.Price.Multiply(item.Quantity)
 }
 
-func (order *Order) UpdateOrderStatus(newStatus util.OrderStatus) error {
-	if order.Status == string(util.OrderStatusCancelled) {
-		return errors.New("Order is already cancelled, Unable to update the status ")
+// OrderStatusChange records a single status transition of an order
+type OrderStatusChange struct {
+	Status    string    `json:"status"`
+	ChangedAt time.Time `json:"changed_at"`
+	ChangedBy string    `json:"changed_by"` // id of the user who made the change
+}
+
+func (order *Order) UpdateOrderStatus(newStatus util.OrderStatus, changedBy string) error {
+	if !util.CanTransitionOrderStatus(util.OrderStatus(order.Status), newStatus) {
+		return fmt.Errorf("%w, from: %s to: %s ", ErrInvalidStatusTransition, order.Status, newStatus)
 	}
 
-	order.Status = string(newStatus)
+	order.setStatus(newStatus, changedBy)
 	return nil
 }
+
+// Place puts a new order in to the placed status and calculates the total
+func (order *Order) Place() error {
+	if len(order.Items) == 0 {
+		return errors.New("Order has no items ")
+	}
+
+	total := money.New(0, order.Items[0].Price.Currency)
+	for _, item := range order.Items {
+		subtotal, err := item.Subtotal()
+		if err != nil {
+			return err
+		}
+
+		total, err = total.Add(subtotal)
+		if err != nil {
+			return err
+		}
+	}
+
+	order.Total = total
+	order.CreatedAt = time.Now().UTC()
+	order.History = nil
+	order.setStatus(util.OrderStatusPlaced, order.UserID)
+	return nil
+}
+
+func (order *Order) setStatus(status util.OrderStatus, changedBy string) {
+	order.Status = string(status)
+	order.History = append(order.History, &OrderStatusChange{
+		Status:    string(status),
+		ChangedAt: time.Now().UTC(),
+		ChangedBy: changedBy,
+	})
+}
+
+// OrderPage is a page of an order listing, newest orders first
+type OrderPage struct {
+	Data       []*Order `json:"data"`
+	NextCursor string   `json:"next_cursor,omitempty"` // not set on the last page
+	Total      int      `json:"total"`                 // orders matching the filter, on all the pages
+	NextPage   int      `json:"next_page,omitempty"`   // set when the page was selected by number
+	Next       *Cursor  `json:"-"`                     // position of the next page, encoded into NextCursor
+}
@@ -1,6 +1,96 @@
 package model
 
+import (
+	"OnlieStore/internal/money"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PaginationParams selects a page either by the page number, or by the cursor when it is set
 type PaginationParams struct {
-	Limit int `json:"limit"`
-	Page  int `json:"page"`
+	Limit  int     `json:"limit"`
+	Page   int     `json:"page"`
+	Cursor *Cursor `json:"-"`
+}
+
+// Cursor is the position of the last item of a page, the next page starts after it. Items added or removed
+// meanwhile do not shift the pages, unlike the page numbers
+type Cursor struct {
+	Key string // sort key of the item, empty when the listing is sorted by id
+	ID  string
+}
+
+// OrderFilter narrows down an order listing, zero values match everything
+type OrderFilter struct {
+	Status string
+	From   time.Time // orders created at or after
+	To     time.Time // orders created before
+}
+
+// Key is the same for the filters which match the same orders
+func (f *OrderFilter) Key() string {
+	return fmt.Sprintf("%s|%d|%d", f.Status, f.From.UnixNano(), f.To.UnixNano())
+}
+
+func (f *OrderFilter) Matches(o *Order) bool {
+	if f.Status != "" && o.Status != f.Status {
+		return false
+	}
+
+	if !f.From.IsZero() && o.CreatedAt.Before(f.From) {
+		return false
+	}
+
+	if !f.To.IsZero() && !o.CreatedAt.Before(f.To) {
+		return false
+	}
+
+	return true
+}
+
+// ProductFilter narrows down and orders a product listing, zero values match everything
+type ProductFilter struct {
+	Category string       // id, slug or name of the category, the products of its sub categories match as well
+	MinPrice *money.Money // inclusive
+	MaxPrice *money.Money // inclusive
+	InStock  bool
+	Name     string // case-insensitive part of the name
+	Sort     string // one of util.ProductSorts, empty sorts by id
+}
+
+// Key is the same for the filters which list the same products in the same order
+func (f *ProductFilter) Key() string {
+	key := fmt.Sprintf("%s|%s|%t|%s", strings.ToLower(f.Category), strings.ToLower(f.Name), f.InStock, f.Sort)
+	for _, price := range []*money.Money{f.MinPrice, f.MaxPrice} {
+		if price == nil {
+			key += "|"
+		} else {
+			key += fmt.Sprintf("|%d", price.Amount)
+		}
+	}
+
+	return key
+}
+
+// Matches checks all but the category, which needs the category tree. The product store picks the products of
+// the category before matching the rest
+func (f *ProductFilter) Matches(s *Stock) bool {
+	if f.MinPrice != nil && s.Product.Price.Amount < f.MinPrice.Amount {
+		return false
+	}
+
+	if f.MaxPrice != nil && s.Product.Price.Amount > f.MaxPrice.Amount {
+		return false
+	}
+
+	if f.InStock && s.CurrentQuantity <= 0 {
+		return false
+	}
+
+	if f.Name != "" && !strings.Contains(strings.ToLower(s.Product.Name), strings.ToLower(f.Name)) {
+		return false
+	}
+
+	return true
 }
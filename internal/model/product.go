@@ -1,17 +1,61 @@
 package model
 
+import (
+	"OnlieStore/internal/money"
+	"time"
+)
+
 type Product struct {
-	ID       string  `json:"id"`
-	Name     string  `json:"name"`
-	Price    float64 `json:"price"`
-	Category string  `json:"category"`
+	ID       string      `json:"id"`
+	Name     string      `json:"name"`
+	Price    money.Money `json:"price"`
+	Category string      `json:"category"` // name of the category
+	// id of the category, empty for an older product whose category did not match any known category
+	CategoryID string `json:"category_id,omitempty"`
+	// set when the product is removed from the catalog, the product is kept for the orders which refer to it
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+func (p *Product) IsDeleted() bool {
+	return p.DeletedAt != nil
 }
 
 // ProductDetails used when a new product is added by admin
 type ProductDetails struct {
-	ID            string  `json:"id"` // used when adding new stock, or deleting stock
-	Name          string  `json:"name"`
-	Price         float64 `json:"price"`
-	Category      string  `json:"category"`
-	AddedQuantity int     `json:"addedQuantity"`
+	ID            string            `json:"id"` // kept when given, otherwise set by the store when the product is added
+	Name          string            `json:"name"`
+	Price         money.Money       `json:"price"`
+	Category      string            `json:"category"`      // id, slug or name of the category
+	AddedQuantity int               `json:"addedQuantity"` // not used when the product has variants
+	Variants      []*VariantDetails `json:"variants,omitempty"`
+}
+
+// VariantDetails used when a product is added with its variants
+type VariantDetails struct {
+	SKU           string            `json:"sku"`
+	Attributes    map[string]string `json:"attributes"`
+	Price         *money.Money      `json:"price,omitempty"` // nil when the variant sells at the price of the product
+	AddedQuantity int               `json:"addedQuantity"`
+}
+
+// ProductUpdate holds the product fields to change, nil fields are left as they are
+type ProductUpdate struct {
+	Name     *string
+	Price    *money.Money
+	Category *string // id, slug or name of the category
+}
+
+// ProductPage is a page of a product listing
+type ProductPage struct {
+	Data       []*Stock `json:"data"`
+	NextCursor string   `json:"next_cursor,omitempty"` // not set on the last page
+	Total      int      `json:"total"`                 // products matching the filter, on all the pages
+	NextPage   int      `json:"next_page,omitempty"`   // set when the page was selected by number
+	Next       *Cursor  `json:"-"`                     // position of the next page, encoded into NextCursor
+}
+
+// ProductSearchResult is a product found by a full text search, higher scores match better
+type ProductSearchResult struct {
+	Product *Stock  `json:"product"`
+	Score   float64 `json:"score"`
 }
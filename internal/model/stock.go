@@ -1,8 +1,58 @@
 package model
 
+import (
+	"OnlieStore/internal/money"
+	"time"
+)
+
+// Stock is a product with its quantities. When the product has variants each variant has its own quantities,
+// and the quantities of the product are their totals
 type Stock struct {
-	ID              string   `json:"id"`
-	Product         *Product `json:"product"`
-	InitialQuantity int      `json:"initial_quantity"`
-	CurrentQuantity int      `json:"current_quantity"`
+	ID              string     `json:"id"`
+	Product         *Product   `json:"product"`
+	InitialQuantity int        `json:"initial_quantity"`
+	CurrentQuantity int        `json:"current_quantity"`
+	Variants        []*Variant `json:"variants,omitempty"`
+}
+
+// Variant is a version of a product, e.g. a size or a colour, sold under its own SKU
+type Variant struct {
+	SKU             string            `json:"sku"`
+	Attributes      map[string]string `json:"attributes"`
+	Price           *money.Money      `json:"price,omitempty"` // overrides the price of the product when set
+	InitialQuantity int               `json:"initial_quantity"`
+	CurrentQuantity int               `json:"current_quantity"`
+}
+
+func (s *Stock) HasVariants() bool {
+	return len(s.Variants) > 0
+}
+
+func (s *Stock) FindVariant(sku string) *Variant {
+	for _, v := range s.Variants {
+		if v.SKU == sku {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// UnitPrice is the price of the variant, or of the product when the variant is nil or has no price of its own
+func (s *Stock) UnitPrice(v *Variant) money.Money {
+	if v != nil && v.Price != nil {
+		return *v.Price
+	}
+
+	return s.Product.Price
+}
+
+// StockLedgerEntry records a single change of the current quantity of a product
+type StockLedgerEntry struct {
+	ProductID string    `json:"product_id"`
+	SKU       string    `json:"sku,omitempty"`      // variant whose quantity changed
+	OrderID   string    `json:"order_id,omitempty"` // order which caused the change, empty for restocks
+	Change    int       `json:"change"`             // positive when units are added to the stock
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
 }
@@ -1,7 +1,40 @@
 package model
 
 type User struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	Password string `json:"password"`
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Role         string     `json:"role"`
+	PasswordHash string     `json:"-"` // bcrypt hash, never sent to the clients
+	Email        string     `json:"email"`
+	DisplayName  string     `json:"display_name"`
+	Addresses    []*Address `json:"addresses"`
+}
+
+// Address is a shipping address of a user
+type Address struct {
+	Label      string `json:"label"` // e.g. home, office
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2"`
+	City       string `json:"city"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"`
+}
+
+// ProfileUpdate holds the profile fields to change, nil fields are left as they are
+type ProfileUpdate struct {
+	Email       *string
+	DisplayName *string
+	Addresses   []*Address // replaces all the addresses when not nil
+}
+
+// Clone returns a copy of the user, so that a change can be prepared without touching the shared user
+func (u *User) Clone() *User {
+	c := *u
+	c.Addresses = make([]*Address, 0, len(u.Addresses))
+	for _, a := range u.Addresses {
+		address := *a
+		c.Addresses = append(c.Addresses, &address)
+	}
+
+	return &c
 }
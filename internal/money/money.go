@@ -0,0 +1,184 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+var ErrOverflow = errors.New("Amount is too large")
+
+// minorUnits is the number of decimal places allowed for each supported ISO 4217 currency
+var minorUnits = map[string]int{
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"AUD": 2,
+	"INR": 2,
+	"LKR": 2,
+	"JPY": 0,
+	"KWD": 3,
+}
+
+// Money is a fixed-point amount, kept in the minor units of its currency (e.g. cents) to avoid rounding errors
+type Money struct {
+	Amount   int64  // amount in minor units
+	Currency string // ISO 4217 currency code
+}
+
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+func IsSupportedCurrency(currency string) bool {
+	_, ok := minorUnits[currency]
+	return ok
+}
+
+// Parse reads a decimal amount such as "19.99" in the given currency. Amounts with more decimal places than
+// the currency allows are rejected instead of being rounded
+func Parse(s string, currency string) (Money, error) {
+	digits, ok := minorUnits[currency]
+	if !ok {
+		return Money{}, errors.New(fmt.Sprintf("Unsupported currency : %s", currency))
+	}
+
+	value := strings.TrimSpace(s)
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(value, "-")
+
+	whole, fraction, hasFraction := strings.Cut(value, ".")
+	if whole == "" || (hasFraction && fraction == "") || !isDigits(whole) || !isDigits(fraction) {
+		return Money{}, errors.New(fmt.Sprintf("Invalid amount : %s", s))
+	}
+
+	if len(fraction) > digits {
+		return Money{}, errors.New(fmt.Sprintf("Amount %s has more than %d decimal places allowed for %s",
+			s, digits, currency))
+	}
+
+	// pad the fraction to the number of minor units, "19.9" is 1990 cents
+	fraction += strings.Repeat("0", digits-len(fraction))
+	amount, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, errors.New(fmt.Sprintf("Invalid amount : %s", s))
+	}
+
+	if negative {
+		amount = -amount
+	}
+
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String returns the decimal amount without the currency, e.g. "19.99"
+func (m Money) String() string {
+	digits := minorUnits[m.Currency]
+	amount := abs(m.Amount)
+	sign := ""
+	if m.Amount < 0 {
+		sign = "-"
+	}
+
+	if digits == 0 {
+		return fmt.Sprintf("%s%d", sign, amount)
+	}
+
+	scale := uint64(1)
+	for i := 0; i < digits; i++ {
+		scale *= 10
+	}
+
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/scale, digits, amount%scale)
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, errors.New(fmt.Sprintf("Currency mismatch : %s and %s", m.Currency, other.Currency))
+	}
+
+	if (other.Amount > 0 && m.Amount > math.MaxInt64-other.Amount) ||
+		(other.Amount < 0 && m.Amount < math.MinInt64-other.Amount) {
+		return Money{}, fmt.Errorf("%w, %s + %s %s", ErrOverflow, m, other, m.Currency)
+	}
+
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+// Multiply returns the amount times the quantity, ErrOverflow when it does not fit in the minor units
+func (m Money) Multiply(quantity int) (Money, error) {
+	negative := (m.Amount < 0) != (quantity < 0)
+	limit := uint64(math.MaxInt64)
+	if negative {
+		limit++ // math.MinInt64
+	}
+
+	hi, lo := bits.Mul64(abs(m.Amount), abs(int64(quantity)))
+	if hi != 0 || lo > limit {
+		return Money{}, fmt.Errorf("%w, %s %s x %d", ErrOverflow, m, m.Currency, quantity)
+	}
+
+	amount := int64(lo)
+	if negative {
+		amount = -amount
+	}
+
+	return Money{Amount: amount, Currency: m.Currency}, nil
+}
+
+// abs works for math.MinInt64 too, whose absolute value only fits in an uint64
+func abs(n int64) uint64 {
+	if n < 0 {
+		return uint64(-n)
+	}
+
+	return uint64(n)
+}
+
+func (m Money) Equal(other Money) bool {
+	return m.Currency == other.Currency && m.Amount == other.Amount
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+type jsonMoney struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// MarshalJSON writes the amount as a decimal string, e.g. {"amount":"19.99","currency":"USD"}
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonMoney{Amount: m.String(), Currency: m.Currency})
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var v jsonMoney
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := Parse(v.Amount, v.Currency)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
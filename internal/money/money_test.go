@@ -0,0 +1,165 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		want     Money
+		wantErr  bool
+	}{
+		{value: "19.99", currency: "USD", want: New(1999, "USD")},
+		{value: "19.9", currency: "USD", want: New(1990, "USD")},
+		{value: "19", currency: "USD", want: New(1900, "USD")},
+		{value: " 0.05 ", currency: "EUR", want: New(5, "EUR")},
+		{value: "-0.05", currency: "USD", want: New(-5, "USD")},
+		{value: "-12.30", currency: "GBP", want: New(-1230, "GBP")},
+		{value: "1500", currency: "JPY", want: New(1500, "JPY")},
+		{value: "1.234", currency: "KWD", want: New(1234, "KWD")},
+		{value: "92233720368547758.07", currency: "USD", want: New(math.MaxInt64, "USD")},
+		// amounts are never rounded, extra decimal places are refused
+		{value: "19.999", currency: "USD", wantErr: true},
+		{value: "19.90", currency: "JPY", wantErr: true},
+		{value: "1.2345", currency: "KWD", wantErr: true},
+		{value: "", currency: "USD", wantErr: true},
+		{value: "-", currency: "USD", wantErr: true},
+		{value: "1.", currency: "USD", wantErr: true},
+		{value: ".5", currency: "USD", wantErr: true},
+		{value: "1.2.3", currency: "USD", wantErr: true},
+		{value: "+1", currency: "USD", wantErr: true},
+		{value: "1e3", currency: "USD", wantErr: true},
+		{value: "--1", currency: "USD", wantErr: true},
+		{value: "92233720368547758.08", currency: "USD", wantErr: true},
+		{value: "1.00", currency: "XYZ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.value, tt.currency)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q, %s) error = %v, want an error: %v", tt.value, tt.currency, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q, %s) = %+v, want %+v", tt.value, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{money: New(1999, "USD"), want: "19.99"},
+		{money: New(5, "USD"), want: "0.05"},
+		{money: New(-5, "USD"), want: "-0.05"},
+		{money: New(-1230, "GBP"), want: "-12.30"},
+		{money: New(0, "EUR"), want: "0.00"},
+		{money: New(1500, "JPY"), want: "1500"},
+		{money: New(1234, "KWD"), want: "1.234"},
+		{money: New(math.MinInt64, "USD"), want: "-92233720368547758.08"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.money.String(); got != tt.want {
+			t.Errorf("%+v.String() = %s, want %s", tt.money, got, tt.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	price := New(-1230, "GBP")
+	data, err := json.Marshal(price)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if got := string(data); got != `{"amount":"-12.30","currency":"GBP"}` {
+		t.Errorf("Marshal() = %s", got)
+	}
+
+	var back Money
+	err = json.Unmarshal(data, &back)
+	if err != nil || back != price {
+		t.Errorf("Unmarshal(%s) = %+v, %v, want %+v", data, back, err, price)
+	}
+
+	for _, invalid := range []string{
+		`{"amount":"12.345","currency":"GBP"}`,
+		`{"amount":"12.34","currency":"XYZ"}`,
+		`{"amount":12.34,"currency":"GBP"}`,
+		`"12.34"`,
+	} {
+		var m Money
+		err = json.Unmarshal([]byte(invalid), &m)
+		if err == nil {
+			t.Errorf("Unmarshal(%s) = %+v, want an error", invalid, m)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		a       Money
+		b       Money
+		want    Money
+		wantErr error
+	}{
+		{name: "same currency", a: New(1999, "USD"), b: New(1, "USD"), want: New(2000, "USD")},
+		{name: "negative", a: New(100, "USD"), b: New(-250, "USD"), want: New(-150, "USD")},
+		{name: "currency mismatch", a: New(100, "USD"), b: New(100, "EUR"), wantErr: errors.New("mismatch")},
+		{name: "overflow", a: New(math.MaxInt64, "USD"), b: New(1, "USD"), wantErr: ErrOverflow},
+		{name: "negative overflow", a: New(math.MinInt64, "USD"), b: New(-1, "USD"), wantErr: ErrOverflow},
+		{name: "up to the limit", a: New(math.MaxInt64-1, "USD"), b: New(1, "USD"), want: New(math.MaxInt64, "USD")},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.a.Add(tt.b)
+		switch {
+		case tt.wantErr == nil && err != nil:
+			t.Errorf("%s: Add() error = %v", tt.name, err)
+		case tt.wantErr == ErrOverflow && !errors.Is(err, ErrOverflow):
+			t.Errorf("%s: Add() error = %v, want %v", tt.name, err, ErrOverflow)
+		case tt.wantErr != nil && err == nil:
+			t.Errorf("%s: Add() = %+v, want an error", tt.name, got)
+		case got != tt.want:
+			t.Errorf("%s: Add() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMultiply(t *testing.T) {
+	tests := []struct {
+		name     string
+		price    Money
+		quantity int
+		want     Money
+		overflow bool
+	}{
+		{name: "units", price: New(1999, "USD"), quantity: 3, want: New(5997, "USD")},
+		{name: "zero", price: New(1999, "USD"), quantity: 0, want: New(0, "USD")},
+		{name: "negative price", price: New(-250, "USD"), quantity: 2, want: New(-500, "USD")},
+		{name: "up to the limit", price: New(math.MaxInt64/2, "USD"), quantity: 2, want: New(math.MaxInt64-1, "USD")},
+		{name: "overflow", price: New(math.MaxInt64/2+1, "USD"), quantity: 2, overflow: true},
+		{name: "large quantity", price: New(1_000_000_00, "USD"), quantity: math.MaxInt32 * 100, overflow: true},
+		{name: "min amount", price: New(math.MinInt64, "USD"), quantity: 1, want: New(math.MinInt64, "USD")},
+		{name: "min amount negated", price: New(math.MinInt64, "USD"), quantity: -1, overflow: true},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.price.Multiply(tt.quantity)
+		if tt.overflow != errors.Is(err, ErrOverflow) {
+			t.Errorf("%s: Multiply() error = %v, want an overflow: %v", tt.name, err, tt.overflow)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: Multiply() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package pagination
+
+import (
+	"OnlieStore/internal/model"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+// Codec turns the cursors into opaque strings. The cursors are signed, so that the clients can not make up
+// positions, and bound to the listing they were made for, so that a cursor of one filter is not used for another
+type Codec struct {
+	secret []byte
+}
+
+func NewCodec(secret string) *Codec {
+	return &Codec{secret: []byte(secret)}
+}
+
+type payload struct {
+	Key   string `json:"k,omitempty"`
+	ID    string `json:"id"`
+	Scope string `json:"s"` // hash of the listing and its filter
+}
+
+// Encode returns the cursor as <payload>.<signature>, both base64url encoded
+func (c *Codec) Encode(cursor *model.Cursor, scope string) (string, error) {
+	data, err := json.Marshal(payload{Key: cursor.Key, ID: cursor.ID, Scope: hashScope(scope)})
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return encoded + "." + c.sign(encoded), nil
+}
+
+// Decode checks the signature and the scope of a cursor made by Encode
+func (c *Codec) Decode(value string, scope string) (*model.Cursor, error) {
+	encoded, signature, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(c.sign(encoded))) {
+		return nil, ErrInvalidCursor
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var p payload
+	err = json.Unmarshal(data, &p)
+	if err != nil || p.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	if p.Scope != hashScope(scope) {
+		return nil, errors.New("Cursor does not belong to this listing, the filter or the sort has changed ")
+	}
+
+	return &model.Cursor{Key: p.Key, ID: p.ID}, nil
+}
+
+func (c *Codec) sign(encoded string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func hashScope(scope string) string {
+	sum := sha256.Sum256([]byte(scope))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"OnlieStore/internal/idgen"
+	"OnlieStore/internal/model"
+	"sort"
+	"sync"
+)
+
+// MemoryProductRepository keeps the product stock in a map, nothing survives a restart
+type MemoryProductRepository struct {
+	mu     sync.RWMutex
+	stock  map[string]*model.Stock // key - product id, value - product stock
+	ledger []*model.StockLedgerEntry
+}
+
+func NewMemoryProductRepository() *MemoryProductRepository {
+	return &MemoryProductRepository{
+		stock:  make(map[string]*model.Stock),
+		ledger: make([]*model.StockLedgerEntry, 0),
+	}
+}
+
+func (r *MemoryProductRepository) SaveStock(stock *model.Stock) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stock[stock.ID] = stock
+	return nil
+}
+
+func (r *MemoryProductRepository) SaveStocks(stocks []*model.Stock) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range stocks {
+		r.stock[s.ID] = s
+	}
+
+	return nil
+}
+
+func (r *MemoryProductRepository) SaveStockMovement(stock *model.Stock, entry *model.StockLedgerEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stock[stock.ID] = stock
+	r.ledger = append(r.ledger, entry)
+	return nil
+}
+
+func (r *MemoryProductRepository) SaveStockMovements(stocks []*model.Stock, entries []*model.StockLedgerEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range stocks {
+		r.stock[s.ID] = s
+	}
+	r.ledger = append(r.ledger, entries...)
+
+	return nil
+}
+
+func (r *MemoryProductRepository) GetAllStock() ([]*model.Stock, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]*model.Stock, 0, len(r.stock))
+	for _, s := range r.stock {
+		result = append(result, s)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return idgen.Compare(result[i].ID, result[j].ID) < 0
+	})
+
+	return result, nil
+}
+
+// MemoryOrderRepository keeps the orders in a map, nothing survives a restart
+type MemoryOrderRepository struct {
+	mu       sync.RWMutex
+	orders   map[string]*model.Order // key - order id, value - order
+	products *MemoryProductRepository
+}
+
+// NewMemoryOrderRepository saves the stock released by the orders into the product repository
+func NewMemoryOrderRepository(products *MemoryProductRepository) *MemoryOrderRepository {
+	return &MemoryOrderRepository{
+		orders:   make(map[string]*model.Order),
+		products: products,
+	}
+}
+
+func (r *MemoryOrderRepository) SaveOrder(order *model.Order) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.orders[order.ID] = order
+	return nil
+}
+
+func (r *MemoryOrderRepository) SaveOrderRelease(order *model.Order, stocks []*model.Stock,
+	entries []*model.StockLedgerEntry) error {
+	// neither save can fail, so the two are all or none
+	err := r.products.SaveStockMovements(stocks, entries)
+	if err != nil {
+		return err
+	}
+
+	return r.SaveOrder(order)
+}
+
+func (r *MemoryOrderRepository) GetAllOrders() ([]*model.Order, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]*model.Order, 0, len(r.orders))
+	for _, o := range r.orders {
+		result = append(result, o)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return idgen.Compare(result[i].ID, result[j].ID) < 0
+	})
+
+	return result, nil
+}
+
+// MemoryUserRepository keeps the users in a map, nothing survives a restart
+type MemoryUserRepository struct {
+	mu    sync.RWMutex
+	users map[string]*model.User // key - user id, value - user
+}
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{
+		users: make(map[string]*model.User),
+	}
+}
+
+func (r *MemoryUserRepository) SaveUser(user *model.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.users[user.ID] = user
+	return nil
+}
+
+func (r *MemoryUserRepository) GetAllUsers() ([]*model.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]*model.User, 0, len(r.users))
+	for _, u := range r.users {
+		result = append(result, u)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return idgen.Compare(result[i].ID, result[j].ID) < 0
+	})
+
+	return result, nil
+}
+
+// MemoryCategoryRepository keeps the categories in a map, nothing survives a restart
+type MemoryCategoryRepository struct {
+	mu         sync.RWMutex
+	categories map[string]*model.Category // key - category id, value - category
+}
+
+func NewMemoryCategoryRepository() *MemoryCategoryRepository {
+	return &MemoryCategoryRepository{
+		categories: make(map[string]*model.Category),
+	}
+}
+
+func (r *MemoryCategoryRepository) SaveCategory(category *model.Category) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.categories[category.ID] = category
+	return nil
+}
+
+// GetAllCategories returns the categories sorted by id, a parent is always added before its children
+func (r *MemoryCategoryRepository) GetAllCategories() ([]*model.Category, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]*model.Category, 0, len(r.categories))
+	for _, c := range r.categories {
+		result = append(result, c)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return idgen.Compare(result[i].ID, result[j].ID) < 0
+	})
+
+	return result, nil
+}
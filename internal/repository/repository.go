@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"OnlieStore/internal/config"
+	"OnlieStore/internal/model"
+	"OnlieStore/internal/util"
+	"errors"
+	"fmt"
+)
+
+// ProductRepository persists the product stock kept by the product store
+type ProductRepository interface {
+	SaveStock(stock *model.Stock) error
+	SaveStocks(stocks []*model.Stock) error                                    // saves all or none of the stocks
+	SaveStockMovement(stock *model.Stock, entry *model.StockLedgerEntry) error // saves the stock with its ledger entry
+	// saves all or none of the stocks with the ledger entries of their changes
+	SaveStockMovements(stocks []*model.Stock, entries []*model.StockLedgerEntry) error
+	GetAllStock() ([]*model.Stock, error)
+}
+
+// CategoryRepository persists the categories kept by the category tree
+type CategoryRepository interface {
+	SaveCategory(category *model.Category) error
+	GetAllCategories() ([]*model.Category, error) // parents come before their children
+}
+
+// OrderRepository persists the orders kept by the order service
+type OrderRepository interface {
+	SaveOrder(order *model.Order) error
+	// saves the order with the stock its units went back to and the ledger entries of the changes, all or none
+	SaveOrderRelease(order *model.Order, stocks []*model.Stock, entries []*model.StockLedgerEntry) error
+	GetAllOrders() ([]*model.Order, error)
+}
+
+// UserRepository persists the users kept by the user manager
+type UserRepository interface {
+	SaveUser(user *model.User) error
+	GetAllUsers() ([]*model.User, error)
+}
+
+type Repositories struct {
+	Products   ProductRepository
+	Orders     OrderRepository
+	Users      UserRepository
+	Categories CategoryRepository
+	closer     func() error
+}
+
+// NewRepositories creates the repositories for the storage selected in the config
+func NewRepositories(cfg *config.Config) (*Repositories, error) {
+	switch cfg.Storage {
+	case "", util.StorageMemory:
+		products := NewMemoryProductRepository()
+		return &Repositories{
+			Products:   products,
+			Orders:     NewMemoryOrderRepository(products),
+			Users:      NewMemoryUserRepository(),
+			Categories: NewMemoryCategoryRepository(),
+			closer:     func() error { return nil },
+		}, nil
+	case util.StorageSQLite:
+		db, err := OpenSQLite(cfg.DatabasePath)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Repositories{
+			Products:   NewSQLiteProductRepository(db),
+			Orders:     NewSQLiteOrderRepository(db),
+			Users:      NewSQLiteUserRepository(db),
+			Categories: NewSQLiteCategoryRepository(db),
+			closer:     db.Close,
+		}, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("Unsupported storage : %s", cfg.Storage))
+	}
+}
+
+func (r *Repositories) Close() error {
+	return r.closer()
+}
@@ -0,0 +1,717 @@
+package repository
+
+import (
+	"OnlieStore/internal/model"
+	"OnlieStore/internal/money"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite"
+	"time"
+)
+
+// migrations are applied in order, a migration must never be changed once released. Add a new one instead.
+var migrations = []string{
+	// 1 - initial schema
+	`CREATE TABLE products (
+		id               TEXT PRIMARY KEY,
+		name             TEXT    NOT NULL,
+		price            REAL    NOT NULL,
+		category         TEXT    NOT NULL,
+		initial_quantity INTEGER NOT NULL,
+		current_quantity INTEGER NOT NULL
+	);
+	CREATE TABLE orders (
+		id         TEXT PRIMARY KEY,
+		user_id    TEXT    NOT NULL,
+		product_id TEXT    NOT NULL,
+		quantity   INTEGER NOT NULL,
+		price      REAL    NOT NULL,
+		status     TEXT    NOT NULL
+	);
+	CREATE INDEX idx_orders_user_id ON orders (user_id);
+	CREATE TABLE users (
+		id       TEXT PRIMARY KEY,
+		name     TEXT NOT NULL UNIQUE,
+		password TEXT NOT NULL
+	);`,
+	// 2 - order status history, existing orders get their current status as the first entry
+	`CREATE TABLE order_status_history (
+		order_id   TEXT NOT NULL REFERENCES orders (id),
+		seq        INTEGER NOT NULL,
+		status     TEXT NOT NULL,
+		changed_at TEXT NOT NULL,
+		changed_by TEXT NOT NULL,
+		PRIMARY KEY (order_id, seq)
+	);
+	INSERT INTO order_status_history (order_id, seq, status, changed_at, changed_by)
+		SELECT id, 0, status, strftime('%Y-%m-%dT%H:%M:%SZ', 'now'), user_id FROM orders;`,
+	// 3 - stock ledger
+	`CREATE TABLE stock_ledger (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		product_id TEXT    NOT NULL REFERENCES products (id),
+		order_id   TEXT    NOT NULL,
+		change     INTEGER NOT NULL,
+		reason     TEXT    NOT NULL,
+		created_at TEXT    NOT NULL
+	);
+	CREATE INDEX idx_stock_ledger_product_id ON stock_ledger (product_id);`,
+	// 4 - orders with multiple line items, existing orders become single line orders
+	`CREATE TABLE order_items (
+		order_id   TEXT    NOT NULL REFERENCES orders (id),
+		seq        INTEGER NOT NULL,
+		product_id TEXT    NOT NULL,
+		quantity   INTEGER NOT NULL,
+		price      REAL    NOT NULL,
+		PRIMARY KEY (order_id, seq)
+	);
+	INSERT INTO order_items (order_id, seq, product_id, quantity, price)
+		SELECT id, 0, product_id, quantity, price FROM orders;
+	ALTER TABLE orders ADD COLUMN total REAL NOT NULL DEFAULT 0;
+	UPDATE orders SET total = price * quantity;
+	ALTER TABLE orders DROP COLUMN product_id;
+	ALTER TABLE orders DROP COLUMN quantity;
+	ALTER TABLE orders DROP COLUMN price;`,
+	// 5 - prices in minor units with the currency. Earlier prices were stored as USD with cents
+	`ALTER TABLE products ADD COLUMN price_amount INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE products ADD COLUMN currency TEXT NOT NULL DEFAULT 'USD';
+	UPDATE products SET price_amount = CAST(ROUND(price * 100) AS INTEGER);
+	ALTER TABLE products DROP COLUMN price;
+	ALTER TABLE orders ADD COLUMN total_amount INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE orders ADD COLUMN currency TEXT NOT NULL DEFAULT 'USD';
+	UPDATE orders SET total_amount = CAST(ROUND(total * 100) AS INTEGER);
+	ALTER TABLE orders DROP COLUMN total;
+	ALTER TABLE order_items ADD COLUMN price_amount INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE order_items ADD COLUMN currency TEXT NOT NULL DEFAULT 'USD';
+	UPDATE order_items SET price_amount = CAST(ROUND(price * 100) AS INTEGER);
+	ALTER TABLE order_items DROP COLUMN price;`,
+	// 6 - passwords are stored as hashes, plaintext rows are hashed by the user manager when loaded
+	`ALTER TABLE users RENAME COLUMN password TO password_hash;`,
+	// 7 - user profile
+	`ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT '';
+	ALTER TABLE users ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+	CREATE TABLE user_addresses (
+		user_id     TEXT    NOT NULL REFERENCES users (id),
+		seq         INTEGER NOT NULL,
+		label       TEXT    NOT NULL,
+		line1       TEXT    NOT NULL,
+		line2       TEXT    NOT NULL,
+		city        TEXT    NOT NULL,
+		postal_code TEXT    NOT NULL,
+		country     TEXT    NOT NULL,
+		PRIMARY KEY (user_id, seq)
+	);`,
+	// 8 - user roles
+	`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'customer';`,
+	// 9 - order creation time, existing orders take the time of their first status
+	`ALTER TABLE orders ADD COLUMN created_at TEXT NOT NULL DEFAULT '';
+	UPDATE orders SET created_at = (SELECT changed_at FROM order_status_history h
+		WHERE h.order_id = orders.id AND h.seq = 0);`,
+	// 10 - soft deleted products, empty while the product is in the catalog
+	`ALTER TABLE products ADD COLUMN deleted_at TEXT NOT NULL DEFAULT '';`,
+	// 11 - product variants, with their own quantities. Attributes are a JSON object, price is NULL when the
+	// variant sells at the price of the product
+	`CREATE TABLE product_variants (
+		sku              TEXT    PRIMARY KEY,
+		product_id       TEXT    NOT NULL REFERENCES products (id),
+		seq              INTEGER NOT NULL,
+		attributes       TEXT    NOT NULL,
+		price_amount     INTEGER,
+		currency         TEXT,
+		initial_quantity INTEGER NOT NULL,
+		current_quantity INTEGER NOT NULL
+	);
+	ALTER TABLE order_items ADD COLUMN sku TEXT NOT NULL DEFAULT '';
+	ALTER TABLE stock_ledger ADD COLUMN sku TEXT NOT NULL DEFAULT '';`,
+	// 12 - category tree. category_id of the existing products is filled in by the product store when loaded
+	`CREATE TABLE categories (
+		id        TEXT PRIMARY KEY,
+		slug      TEXT NOT NULL UNIQUE,
+		name      TEXT NOT NULL,
+		parent_id TEXT NOT NULL DEFAULT ''
+	);
+	ALTER TABLE products ADD COLUMN category_id TEXT NOT NULL DEFAULT '';`,
+}
+
+// OpenSQLite opens the database file and brings the schema up to date
+func OpenSQLite(path string) (*sql.DB, error) {
+	if path == "" {
+		return nil, errors.New("Database path is required for sqlite storage ")
+	}
+
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)", path))
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite allows a single writer, serialise the access through one connection
+	db.SetMaxOpenConns(1)
+
+	err = migrate(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func migrate(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	err = db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(migrations[i])
+		if err == nil {
+			_, err = tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, version)
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return errors.New(fmt.Sprintf("Failed to apply migration %d : %s", version, err.Error()))
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+
+		logrus.WithField("version", version).Info("Applied database migration")
+	}
+
+	return nil
+}
+
+type SQLiteProductRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteProductRepository(db *sql.DB) *SQLiteProductRepository {
+	return &SQLiteProductRepository{db: db}
+}
+
+func (r *SQLiteProductRepository) SaveStock(stock *model.Stock) error {
+	// a product is saved with its variants, in a single transaction
+	return r.SaveStocks([]*model.Stock{stock})
+}
+
+func (r *SQLiteProductRepository) SaveStocks(stocks []*model.Stock) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, s := range stocks {
+		err = saveStock(tx, s)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *SQLiteProductRepository) SaveStockMovement(stock *model.Stock, entry *model.StockLedgerEntry) error {
+	return r.SaveStockMovements([]*model.Stock{stock}, []*model.StockLedgerEntry{entry})
+}
+
+func (r *SQLiteProductRepository) SaveStockMovements(stocks []*model.Stock, entries []*model.StockLedgerEntry) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = saveStockMovements(tx, stocks, entries)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func saveStockMovements(db execer, stocks []*model.Stock, entries []*model.StockLedgerEntry) error {
+	for _, s := range stocks {
+		err := saveStock(db, s)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range entries {
+		_, err := db.Exec(`INSERT INTO stock_ledger (product_id, sku, order_id, change, reason, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			entry.ProductID, entry.SKU, entry.OrderID, entry.Change, entry.Reason,
+			entry.CreatedAt.Format(time.RFC3339Nano))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func saveStock(db execer, stock *model.Stock) error {
+	deletedAt := ""
+	if stock.Product.DeletedAt != nil {
+		deletedAt = stock.Product.DeletedAt.Format(time.RFC3339Nano)
+	}
+
+	_, err := db.Exec(`INSERT INTO products (id, name, price_amount, currency, category, category_id,
+			initial_quantity, current_quantity, deleted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET name = excluded.name, price_amount = excluded.price_amount,
+			currency = excluded.currency, category = excluded.category, category_id = excluded.category_id,
+			initial_quantity = excluded.initial_quantity, current_quantity = excluded.current_quantity,
+			deleted_at = excluded.deleted_at`,
+		stock.ID, stock.Product.Name, stock.Product.Price.Amount, stock.Product.Price.Currency,
+		stock.Product.Category, stock.Product.CategoryID, stock.InitialQuantity, stock.CurrentQuantity, deletedAt)
+	if err != nil {
+		return err
+	}
+
+	for i, v := range stock.Variants {
+		attributes, err := json.Marshal(v.Attributes)
+		if err != nil {
+			return err
+		}
+
+		var priceAmount, currency any
+		if v.Price != nil {
+			priceAmount, currency = v.Price.Amount, v.Price.Currency
+		}
+
+		_, err = db.Exec(`INSERT INTO product_variants (sku, product_id, seq, attributes, price_amount, currency,
+				initial_quantity, current_quantity)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (sku) DO UPDATE SET attributes = excluded.attributes, price_amount = excluded.price_amount,
+				currency = excluded.currency, initial_quantity = excluded.initial_quantity,
+				current_quantity = excluded.current_quantity`,
+			v.SKU, stock.ID, i, string(attributes), priceAmount, currency, v.InitialQuantity, v.CurrentQuantity)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *SQLiteProductRepository) GetAllStock() ([]*model.Stock, error) {
+	rows, err := r.db.Query(`SELECT id, name, price_amount, currency, category, category_id, initial_quantity,
+			current_quantity, deleted_at
+		FROM products ORDER BY length(id), id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*model.Stock, 0)
+	for rows.Next() {
+		var deletedAt string
+		s := &model.Stock{Product: &model.Product{}}
+		err = rows.Scan(&s.ID, &s.Product.Name, &s.Product.Price.Amount, &s.Product.Price.Currency,
+			&s.Product.Category, &s.Product.CategoryID, &s.InitialQuantity, &s.CurrentQuantity, &deletedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if deletedAt != "" {
+			t, err := time.Parse(time.RFC3339Nano, deletedAt)
+			if err != nil {
+				return nil, err
+			}
+			s.Product.DeletedAt = &t
+		}
+
+		s.Product.ID = s.ID
+		result = append(result, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, r.loadVariants(result)
+}
+
+func (r *SQLiteProductRepository) loadVariants(stocks []*model.Stock) error {
+	byID := make(map[string]*model.Stock, len(stocks))
+	for _, s := range stocks {
+		byID[s.ID] = s
+	}
+
+	rows, err := r.db.Query(`SELECT product_id, sku, attributes, price_amount, currency, initial_quantity,
+			current_quantity
+		FROM product_variants ORDER BY product_id, seq`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID, attributes string
+		var priceAmount sql.NullInt64
+		var currency sql.NullString
+		v := &model.Variant{}
+		err = rows.Scan(&productID, &v.SKU, &attributes, &priceAmount, &currency, &v.InitialQuantity,
+			&v.CurrentQuantity)
+		if err != nil {
+			return err
+		}
+
+		err = json.Unmarshal([]byte(attributes), &v.Attributes)
+		if err != nil {
+			return err
+		}
+
+		if priceAmount.Valid {
+			price := money.New(priceAmount.Int64, currency.String)
+			v.Price = &price
+		}
+
+		if s, ok := byID[productID]; ok {
+			s.Variants = append(s.Variants, v)
+		}
+	}
+
+	return rows.Err()
+}
+
+type SQLiteCategoryRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteCategoryRepository(db *sql.DB) *SQLiteCategoryRepository {
+	return &SQLiteCategoryRepository{db: db}
+}
+
+func (r *SQLiteCategoryRepository) SaveCategory(category *model.Category) error {
+	_, err := r.db.Exec(`INSERT INTO categories (id, slug, name, parent_id) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET slug = excluded.slug, name = excluded.name, parent_id = excluded.parent_id`,
+		category.ID, category.Slug, category.Name, category.ParentID)
+	return err
+}
+
+// GetAllCategories returns the categories sorted by id, a parent is always added before its children
+func (r *SQLiteCategoryRepository) GetAllCategories() ([]*model.Category, error) {
+	rows, err := r.db.Query(`SELECT id, slug, name, parent_id FROM categories ORDER BY length(id), id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*model.Category, 0)
+	for rows.Next() {
+		c := &model.Category{}
+		err = rows.Scan(&c.ID, &c.Slug, &c.Name, &c.ParentID)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, c)
+	}
+
+	return result, rows.Err()
+}
+
+type SQLiteOrderRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteOrderRepository(db *sql.DB) *SQLiteOrderRepository {
+	return &SQLiteOrderRepository{db: db}
+}
+
+func (r *SQLiteOrderRepository) SaveOrder(order *model.Order) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = saveOrder(tx, order)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SaveOrderRelease saves the order and the released stock in a single transaction
+func (r *SQLiteOrderRepository) SaveOrderRelease(order *model.Order, stocks []*model.Stock,
+	entries []*model.StockLedgerEntry) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = saveOrder(tx, order)
+	if err != nil {
+		return err
+	}
+
+	err = saveStockMovements(tx, stocks, entries)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func saveOrder(tx *sql.Tx, order *model.Order) error {
+	_, err := tx.Exec(`INSERT INTO orders (id, user_id, total_amount, currency, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET status = excluded.status`,
+		order.ID, order.UserID, order.Total.Amount, order.Total.Currency, order.Status,
+		order.CreatedAt.Format(time.RFC3339Nano))
+	if err != nil {
+		return err
+	}
+
+	// items do not change once the order is placed
+	for i, item := range order.Items {
+		_, err = tx.Exec(`INSERT INTO order_items (order_id, seq, product_id, sku, quantity, price_amount, currency)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (order_id, seq) DO NOTHING`,
+			order.ID, i, item.ProductID, item.SKU, item.Quantity, item.Price.Amount, item.Price.Currency)
+		if err != nil {
+			return err
+		}
+	}
+
+	// history is append only, write the entries which are not saved yet
+	var saved int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM order_status_history WHERE order_id = ?`, order.ID).Scan(&saved)
+	if err != nil {
+		return err
+	}
+
+	for i := saved; i < len(order.History); i++ {
+		h := order.History[i]
+		_, err = tx.Exec(`INSERT INTO order_status_history (order_id, seq, status, changed_at, changed_by)
+			VALUES (?, ?, ?, ?, ?)`,
+			order.ID, i, h.Status, h.ChangedAt.Format(time.RFC3339Nano), h.ChangedBy)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *SQLiteOrderRepository) GetAllOrders() ([]*model.Order, error) {
+	rows, err := r.db.Query(`SELECT id, user_id, total_amount, currency, status, created_at FROM orders
+		ORDER BY length(id), id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*model.Order, 0)
+	orders := make(map[string]*model.Order)
+	for rows.Next() {
+		var createdAt string
+		o := &model.Order{}
+		err = rows.Scan(&o.ID, &o.UserID, &o.Total.Amount, &o.Total.Currency, &o.Status, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+
+		o.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, o)
+		orders[o.ID] = o
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = r.loadItems(orders)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.loadHistory(orders)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *SQLiteOrderRepository) loadItems(orders map[string]*model.Order) error {
+	rows, err := r.db.Query(`SELECT order_id, product_id, sku, quantity, price_amount, currency FROM order_items
+		ORDER BY order_id, seq`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderID string
+		item := &model.OrderItem{}
+		err = rows.Scan(&orderID, &item.ProductID, &item.SKU, &item.Quantity, &item.Price.Amount,
+			&item.Price.Currency)
+		if err != nil {
+			return err
+		}
+
+		if o, ok := orders[orderID]; ok {
+			o.Items = append(o.Items, item)
+		}
+	}
+
+	return rows.Err()
+}
+
+func (r *SQLiteOrderRepository) loadHistory(orders map[string]*model.Order) error {
+	rows, err := r.db.Query(`SELECT order_id, status, changed_at, changed_by FROM order_status_history
+		ORDER BY order_id, seq`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderID, changedAt string
+		h := &model.OrderStatusChange{}
+		err = rows.Scan(&orderID, &h.Status, &changedAt, &h.ChangedBy)
+		if err != nil {
+			return err
+		}
+
+		h.ChangedAt, err = time.Parse(time.RFC3339Nano, changedAt)
+		if err != nil {
+			return err
+		}
+
+		if o, ok := orders[orderID]; ok {
+			o.History = append(o.History, h)
+		}
+	}
+
+	return rows.Err()
+}
+
+type SQLiteUserRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteUserRepository(db *sql.DB) *SQLiteUserRepository {
+	return &SQLiteUserRepository{db: db}
+}
+
+func (r *SQLiteUserRepository) SaveUser(user *model.User) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO users (id, name, role, password_hash, email, display_name) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET name = excluded.name, role = excluded.role,
+			password_hash = excluded.password_hash, email = excluded.email, display_name = excluded.display_name`,
+		user.ID, user.Name, user.Role, user.PasswordHash, user.Email, user.DisplayName)
+	if err != nil {
+		return err
+	}
+
+	// addresses are replaced as a whole
+	_, err = tx.Exec(`DELETE FROM user_addresses WHERE user_id = ?`, user.ID)
+	if err != nil {
+		return err
+	}
+
+	for i, a := range user.Addresses {
+		_, err = tx.Exec(`INSERT INTO user_addresses (user_id, seq, label, line1, line2, city, postal_code, country)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			user.ID, i, a.Label, a.Line1, a.Line2, a.City, a.PostalCode, a.Country)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *SQLiteUserRepository) GetAllUsers() ([]*model.User, error) {
+	rows, err := r.db.Query(`SELECT id, name, role, password_hash, email, display_name FROM users ORDER BY length(id), id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*model.User, 0)
+	users := make(map[string]*model.User)
+	for rows.Next() {
+		u := &model.User{Addresses: []*model.Address{}}
+		err = rows.Scan(&u.ID, &u.Name, &u.Role, &u.PasswordHash, &u.Email, &u.DisplayName)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, u)
+		users[u.ID] = u
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = r.loadAddresses(users)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *SQLiteUserRepository) loadAddresses(users map[string]*model.User) error {
+	rows, err := r.db.Query(`SELECT user_id, label, line1, line2, city, postal_code, country FROM user_addresses
+		ORDER BY user_id, seq`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID string
+		a := &model.Address{}
+		err = rows.Scan(&userID, &a.Label, &a.Line1, &a.Line2, &a.City, &a.PostalCode, &a.Country)
+		if err != nil {
+			return err
+		}
+
+		if u, ok := users[userID]; ok {
+			u.Addresses = append(u.Addresses, a)
+		}
+	}
+
+	return rows.Err()
+}
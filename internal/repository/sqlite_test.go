@@ -0,0 +1,418 @@
+package repository
+
+import (
+	"OnlieStore/internal/model"
+	"OnlieStore/internal/money"
+	"OnlieStore/internal/util"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatalf("failed to open the database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
+
+func countRows(t *testing.T, db *sql.DB, table string) int {
+	t.Helper()
+
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n)
+	if err != nil {
+		t.Fatalf("failed to count the rows of %s: %v", table, err)
+	}
+
+	return n
+}
+
+// TestMigrateFromV1 fills a database at the first schema version and opens it, which applies the later
+// migrations to the existing rows
+func TestMigrateFromV1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.db")
+
+	v1, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("failed to open the database: %v", err)
+	}
+	for _, statement := range []string{
+		`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY)`,
+		migrations[0],
+		`INSERT INTO schema_migrations (version) VALUES (1)`,
+		`INSERT INTO products (id, name, price, category, initial_quantity, current_quantity)
+			VALUES ('P00001', 'WirelessMouse', 19.99, 'electronics', 10, 8)`,
+		`INSERT INTO orders (id, user_id, product_id, quantity, price, status)
+			VALUES ('00001', 'U00001', 'P00001', 2, 19.99, 'placed')`,
+		`INSERT INTO users (id, name, password) VALUES ('U00001', 'alice.silva', 'Test@123')`,
+	} {
+		_, err = v1.Exec(statement)
+		if err != nil {
+			t.Fatalf("failed to set up the v1 database: %v", err)
+		}
+	}
+	_ = v1.Close()
+
+	db, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("failed to migrate the database: %v", err)
+	}
+	defer db.Close()
+
+	var version int
+	err = db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version)
+	if err != nil || version != len(migrations) {
+		t.Fatalf("schema version = %d, %v, want %d", version, err, len(migrations))
+	}
+
+	stocks, err := NewSQLiteProductRepository(db).GetAllStock()
+	if err != nil || len(stocks) != 1 {
+		t.Fatalf("GetAllStock() = %v, %v, want one product", stocks, err)
+	}
+	if got := stocks[0].Product.Price; got != money.New(1999, "USD") {
+		t.Errorf("price = %v, want 19.99 USD", got)
+	}
+	if stocks[0].CurrentQuantity != 8 || stocks[0].Product.IsDeleted() {
+		t.Errorf("product = %+v, want 8 units in the catalog", stocks[0])
+	}
+
+	orders, err := NewSQLiteOrderRepository(db).GetAllOrders()
+	if err != nil || len(orders) != 1 {
+		t.Fatalf("GetAllOrders() = %v, %v, want one order", orders, err)
+	}
+	o := orders[0]
+	if o.Total != money.New(3998, "USD") || len(o.Items) != 1 || len(o.History) != 1 {
+		t.Fatalf("order = %+v, want a single line order of 39.98 USD with one status", o)
+	}
+	if item := o.Items[0]; item.ProductID != "P00001" || item.Quantity != 2 || item.Price != money.New(1999, "USD") {
+		t.Errorf("item = %+v, want 2 x P00001 at 19.99 USD", item)
+	}
+	if o.History[0].Status != string(util.OrderStatusPlaced) || !o.CreatedAt.Equal(o.History[0].ChangedAt) {
+		t.Errorf("history = %+v, created at %v, want placed at the creation time", o.History[0], o.CreatedAt)
+	}
+
+	users, err := NewSQLiteUserRepository(db).GetAllUsers()
+	if err != nil || len(users) != 1 {
+		t.Fatalf("GetAllUsers() = %v, %v, want one user", users, err)
+	}
+	// the plaintext password is moved to the hash column, the user manager hashes it when loaded
+	if u := users[0]; u.PasswordHash != "Test@123" || u.Role != util.RoleCustomer {
+		t.Errorf("user = %+v, want the old password and the customer role", u)
+	}
+}
+
+func TestSQLiteProductRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewSQLiteProductRepository(db)
+
+	deletedAt := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	variantPrice := money.New(2499, "USD")
+	stocks := []*model.Stock{
+		{
+			ID: "P00001",
+			Product: &model.Product{ID: "P00001", Name: "WirelessMouse", Price: money.New(1999, "USD"),
+				Category: "Electronics", CategoryID: "C00001"},
+			InitialQuantity: 10,
+			CurrentQuantity: 7,
+		},
+		{
+			ID: "P00002",
+			Product: &model.Product{ID: "P00002", Name: "CottonTShirt", Price: money.New(1500, "USD"),
+				Category: "Clothing", CategoryID: "C00002"},
+			InitialQuantity: 20,
+			CurrentQuantity: 15,
+			Variants: []*model.Variant{
+				{SKU: "TS-S", Attributes: map[string]string{"size": "S"}, InitialQuantity: 10, CurrentQuantity: 10},
+				{SKU: "TS-L", Attributes: map[string]string{"size": "L"}, Price: &variantPrice, InitialQuantity: 10,
+					CurrentQuantity: 5},
+			},
+		},
+		{
+			ID: "P00003",
+			Product: &model.Product{ID: "P00003", Name: "OldLamp", Price: money.New(5000, "USD"),
+				Category: "Home", DeletedAt: &deletedAt},
+			InitialQuantity: 3,
+			CurrentQuantity: 3,
+		},
+	}
+
+	err := repo.SaveStocks(stocks)
+	if err != nil {
+		t.Fatalf("SaveStocks() error = %v", err)
+	}
+
+	// a second save updates the rows in place
+	stocks[1].Variants[1].CurrentQuantity = 4
+	stocks[1].CurrentQuantity = 14
+	err = repo.SaveStock(stocks[1])
+	if err != nil {
+		t.Fatalf("SaveStock() error = %v", err)
+	}
+
+	got, err := repo.GetAllStock()
+	if err != nil {
+		t.Fatalf("GetAllStock() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, stocks) {
+		t.Errorf("GetAllStock() = %+v, want %+v", got, stocks)
+	}
+}
+
+func TestSQLiteOrderRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewSQLiteOrderRepository(db)
+
+	placedAt := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	order := &model.Order{
+		ID:     "00001",
+		UserID: "U00001",
+		Items: []*model.OrderItem{
+			{ProductID: "P00001", Quantity: 2, Price: money.New(1999, "USD")},
+			{ProductID: "P00002", SKU: "TS-L", Quantity: 1, Price: money.New(2499, "USD")},
+		},
+		Total:     money.New(6497, "USD"),
+		Status:    string(util.OrderStatusPlaced),
+		CreatedAt: placedAt,
+		History: []*model.OrderStatusChange{
+			{Status: string(util.OrderStatusPlaced), ChangedAt: placedAt, ChangedBy: "U00001"},
+		},
+	}
+
+	err := repo.SaveOrder(order)
+	if err != nil {
+		t.Fatalf("SaveOrder() error = %v", err)
+	}
+
+	order.Status = string(util.OrderStatusConfirmed)
+	order.History = append(order.History, &model.OrderStatusChange{Status: order.Status,
+		ChangedAt: placedAt.Add(time.Hour), ChangedBy: "U00002"})
+	err = repo.SaveOrder(order)
+	if err != nil {
+		t.Fatalf("SaveOrder() error = %v", err)
+	}
+
+	got, err := repo.GetAllOrders()
+	if err != nil {
+		t.Fatalf("GetAllOrders() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, []*model.Order{order}) {
+		t.Errorf("GetAllOrders() = %+v, want %+v", got, order)
+	}
+}
+
+func TestSQLiteUserRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewSQLiteUserRepository(db)
+
+	user := &model.User{
+		ID:           "U00001",
+		Name:         "alice.silva",
+		Role:         util.RoleAdmin,
+		PasswordHash: "$2a$10$hash",
+		Email:        "alice@example.com",
+		DisplayName:  "Alice",
+		Addresses: []*model.Address{
+			{Label: "home", Line1: "1 Main St", City: "Colombo", PostalCode: "00100", Country: "LK"},
+			{Label: "office", Line1: "2 Park Rd", Line2: "Floor 3", City: "Kandy", PostalCode: "20000",
+				Country: "LK"},
+		},
+	}
+
+	err := repo.SaveUser(user)
+	if err != nil {
+		t.Fatalf("SaveUser() error = %v", err)
+	}
+
+	// the addresses are replaced as a whole
+	user.Addresses = user.Addresses[1:]
+	user.Role = util.RoleStaff
+	err = repo.SaveUser(user)
+	if err != nil {
+		t.Fatalf("SaveUser() error = %v", err)
+	}
+
+	got, err := repo.GetAllUsers()
+	if err != nil {
+		t.Fatalf("GetAllUsers() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, []*model.User{user}) {
+		t.Errorf("GetAllUsers() = %+v, want %+v", got, user)
+	}
+}
+
+func TestSQLiteCategoryRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewSQLiteCategoryRepository(db)
+
+	categories := []*model.Category{
+		{ID: "C00001", Slug: "electronics", Name: "Electronics"},
+		{ID: "C00002", Slug: "mice", Name: "Mice", ParentID: "C00001"},
+	}
+	for _, c := range categories {
+		err := repo.SaveCategory(c)
+		if err != nil {
+			t.Fatalf("SaveCategory() error = %v", err)
+		}
+	}
+
+	got, err := repo.GetAllCategories()
+	if err != nil {
+		t.Fatalf("GetAllCategories() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, categories) {
+		t.Errorf("GetAllCategories() = %+v, want %+v", got, categories)
+	}
+}
+
+// TestSQLiteIDOrder checks that the ids come back by length then text, the order they were made in
+func TestSQLiteIDOrder(t *testing.T) {
+	db := openTestDB(t)
+	ids := []string{"P100000", "P99999", "P00002"}
+	want := []string{"P00002", "P99999", "P100000"}
+
+	products := NewSQLiteProductRepository(db)
+	users := NewSQLiteUserRepository(db)
+	for _, id := range ids {
+		err := products.SaveStock(&model.Stock{ID: id, Product: &model.Product{ID: id, Name: id,
+			Price: money.New(100, "USD")}})
+		if err != nil {
+			t.Fatalf("SaveStock() error = %v", err)
+		}
+
+		err = users.SaveUser(&model.User{ID: id, Name: id, Role: util.RoleCustomer})
+		if err != nil {
+			t.Fatalf("SaveUser() error = %v", err)
+		}
+	}
+
+	stocks, err := products.GetAllStock()
+	if err != nil {
+		t.Fatalf("GetAllStock() error = %v", err)
+	}
+	all, err := users.GetAllUsers()
+	if err != nil {
+		t.Fatalf("GetAllUsers() error = %v", err)
+	}
+
+	for i, id := range want {
+		if stocks[i].ID != id || all[i].ID != id {
+			t.Errorf("position %d: product %s, user %s, want %s", i, stocks[i].ID, all[i].ID, id)
+		}
+	}
+}
+
+// TestSQLiteStockMovementsAtomic saves the stock with ledger entries, an entry of a missing product fails the
+// transaction part way through, after the order and the stock rows were written
+func TestSQLiteStockMovementsAtomic(t *testing.T) {
+	tests := []struct {
+		name        string
+		withOrder   bool
+		productID   string // of the ledger entry
+		wantErr     bool
+		wantQty     int
+		wantStatus  util.OrderStatus
+		wantLedger  int
+		wantHistory int
+	}{
+		{name: "stock movements", productID: "P00001", wantQty: 12, wantLedger: 1},
+		{name: "stock movements fail", productID: "P404", wantErr: true, wantQty: 10},
+		{
+			name:        "order release",
+			withOrder:   true,
+			productID:   "P00001",
+			wantQty:     12,
+			wantStatus:  util.OrderStatusCancelled,
+			wantLedger:  1,
+			wantHistory: 2,
+		},
+		{
+			name:        "order release fails",
+			withOrder:   true,
+			productID:   "P404",
+			wantErr:     true,
+			wantQty:     10,
+			wantStatus:  util.OrderStatusPlaced,
+			wantHistory: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			products := NewSQLiteProductRepository(db)
+			orders := NewSQLiteOrderRepository(db)
+
+			stock := &model.Stock{ID: "P00001", Product: &model.Product{ID: "P00001", Name: "WirelessMouse",
+				Price: money.New(1999, "USD")}, InitialQuantity: 10, CurrentQuantity: 10}
+			err := products.SaveStock(stock)
+			if err != nil {
+				t.Fatalf("SaveStock() error = %v", err)
+			}
+
+			now := time.Now().UTC()
+			order := &model.Order{ID: "00001", UserID: "U00001", Total: money.New(3998, "USD"),
+				Status: string(util.OrderStatusPlaced), CreatedAt: now,
+				Items: []*model.OrderItem{{ProductID: "P00001", Quantity: 2, Price: money.New(1999, "USD")}},
+				History: []*model.OrderStatusChange{
+					{Status: string(util.OrderStatusPlaced), ChangedAt: now, ChangedBy: "U00001"}}}
+			err = orders.SaveOrder(order)
+			if err != nil {
+				t.Fatalf("SaveOrder() error = %v", err)
+			}
+
+			stock.CurrentQuantity = 12
+			entries := []*model.StockLedgerEntry{
+				{ProductID: "P00001", OrderID: order.ID, Change: 2, Reason: util.StockReasonReleased, CreatedAt: now},
+				{ProductID: tt.productID, OrderID: order.ID, Change: 0, Reason: util.StockReasonReleased,
+					CreatedAt: now},
+			}
+			if tt.productID == "P00001" {
+				entries = entries[:1]
+			}
+
+			if tt.withOrder {
+				order.Status = string(util.OrderStatusCancelled)
+				order.History = append(order.History, &model.OrderStatusChange{Status: order.Status,
+					ChangedAt: now, ChangedBy: "U00002"})
+				err = orders.SaveOrderRelease(order, []*model.Stock{stock}, entries)
+			} else {
+				err = products.SaveStockMovements([]*model.Stock{stock}, entries)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("save error = %v, want an error: %v", err, tt.wantErr)
+			}
+
+			stocks, err := products.GetAllStock()
+			if err != nil {
+				t.Fatalf("GetAllStock() error = %v", err)
+			}
+			if stocks[0].CurrentQuantity != tt.wantQty {
+				t.Errorf("quantity = %d, want %d", stocks[0].CurrentQuantity, tt.wantQty)
+			}
+			if got := countRows(t, db, "stock_ledger"); got != tt.wantLedger {
+				t.Errorf("ledger entries = %d, want %d", got, tt.wantLedger)
+			}
+
+			if tt.withOrder {
+				saved, err := orders.GetAllOrders()
+				if err != nil {
+					t.Fatalf("GetAllOrders() error = %v", err)
+				}
+				if got := util.OrderStatus(saved[0].Status); got != tt.wantStatus {
+					t.Errorf("status = %s, want %s", got, tt.wantStatus)
+				}
+				if got := len(saved[0].History); got != tt.wantHistory {
+					t.Errorf("history entries = %d, want %d", got, tt.wantHistory)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package search
+
+import (
+	"OnlieStore/internal/idgen"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// scores of a match on a term, multiplied by the weight of the field the term came from
+const (
+	scoreExact  = 1.0
+	scorePrefix = 0.6
+	scoreTypo   = 0.4
+)
+
+// shortest query tokens which are matched as prefixes or with a typo, shorter ones match too much
+const (
+	minPrefixLength = 2
+	minTypoLength   = 4
+)
+
+// Index is an inverted index over the fields of documents, e.g. the name and the category of products.
+// It does not lock, the owner guards it so that it is not read while being changed
+type Index struct {
+	postings map[string]map[string]float64 // key - term, value - weight per document id
+	docTerms map[string][]string           // key - document id, value - terms of the document
+	terms    []string                      // sorted, for the prefix lookups
+	deletes  map[string][]string           // key - term with one letter deleted, value - terms it came from
+}
+
+// Field is a text of a document with its weight in the score
+type Field struct {
+	Text   string
+	Weight float64
+}
+
+type Result struct {
+	ID    string
+	Score float64
+}
+
+func NewIndex() *Index {
+	return &Index{
+		postings: make(map[string]map[string]float64),
+		docTerms: make(map[string][]string),
+		deletes:  make(map[string][]string),
+	}
+}
+
+// Add indexes the document, replacing what was indexed for the same id before
+func (idx *Index) Add(id string, fields ...Field) {
+	idx.Remove(id)
+
+	weights := make(map[string]float64)
+	for _, f := range fields {
+		for _, term := range Tokenize(f.Text) {
+			weights[term] = max(weights[term], f.Weight)
+		}
+	}
+
+	for term, weight := range weights {
+		docs, ok := idx.postings[term]
+		if !ok {
+			docs = make(map[string]float64)
+			idx.postings[term] = docs
+			idx.addTerm(term)
+		}
+
+		docs[id] = weight
+		idx.docTerms[id] = append(idx.docTerms[id], term)
+	}
+}
+
+func (idx *Index) Remove(id string) {
+	for _, term := range idx.docTerms[id] {
+		docs := idx.postings[term]
+		delete(docs, id)
+		if len(docs) == 0 {
+			delete(idx.postings, term)
+			idx.removeTerm(term)
+		}
+	}
+
+	delete(idx.docTerms, id)
+}
+
+// Search scores the documents against each token of the query, by exact, prefix and typo matches. Documents
+// matching more tokens or better rank first, the ties in the order the documents were made
+func (idx *Index) Search(query string) []*Result {
+	scores := make(map[string]float64)
+	for _, token := range Tokenize(query) {
+		// a document counts once per token, with its best match
+		best := make(map[string]float64)
+		for term, score := range idx.matchingTerms(token) {
+			for id, weight := range idx.postings[term] {
+				best[id] = max(best[id], score*weight)
+			}
+		}
+
+		for id, score := range best {
+			scores[id] += score
+		}
+	}
+
+	result := make([]*Result, 0, len(scores))
+	for id, score := range scores {
+		result = append(result, &Result{ID: id, Score: score})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Score != result[j].Score {
+			return result[i].Score > result[j].Score
+		}
+		return idgen.Compare(result[i].ID, result[j].ID) < 0
+	})
+
+	return result
+}
+
+// matchingTerms returns the indexed terms matching the token, with the score of the match
+func (idx *Index) matchingTerms(token string) map[string]float64 {
+	matches := make(map[string]float64)
+	if _, ok := idx.postings[token]; ok {
+		matches[token] = scoreExact
+	}
+
+	if len(token) >= minPrefixLength {
+		for i := sort.SearchStrings(idx.terms, token); i < len(idx.terms); i++ {
+			if !strings.HasPrefix(idx.terms[i], token) {
+				break
+			}
+			if _, ok := matches[idx.terms[i]]; !ok {
+				matches[idx.terms[i]] = scorePrefix
+			}
+		}
+	}
+
+	if len(token) >= minTypoLength {
+		for _, term := range idx.typoCandidates(token) {
+			if _, ok := matches[term]; !ok && withinOneEdit(token, term) {
+				matches[term] = scoreTypo
+			}
+		}
+	}
+
+	return matches
+}
+
+// typoCandidates looks up the terms sharing a one letter deletion with the token. These are the terms one
+// insertion, deletion or substitution away, plus a few which are not and are checked by the caller
+func (idx *Index) typoCandidates(token string) []string {
+	candidates := append([]string{}, idx.deletes[token]...)
+
+	for _, d := range oneDeletions(token) {
+		if _, ok := idx.postings[d]; ok {
+			candidates = append(candidates, d)
+		}
+		candidates = append(candidates, idx.deletes[d]...)
+	}
+
+	return candidates
+}
+
+func (idx *Index) addTerm(term string) {
+	i := sort.SearchStrings(idx.terms, term)
+	idx.terms = append(idx.terms, "")
+	copy(idx.terms[i+1:], idx.terms[i:])
+	idx.terms[i] = term
+
+	for _, d := range oneDeletions(term) {
+		idx.deletes[d] = append(idx.deletes[d], term)
+	}
+}
+
+func (idx *Index) removeTerm(term string) {
+	i := sort.SearchStrings(idx.terms, term)
+	if i < len(idx.terms) && idx.terms[i] == term {
+		idx.terms = append(idx.terms[:i], idx.terms[i+1:]...)
+	}
+
+	for _, d := range oneDeletions(term) {
+		terms := idx.deletes[d]
+		for j, t := range terms {
+			if t == term {
+				terms = append(terms[:j], terms[j+1:]...)
+				break
+			}
+		}
+
+		if len(terms) == 0 {
+			delete(idx.deletes, d)
+		} else {
+			idx.deletes[d] = terms
+		}
+	}
+}
+
+// Tokenize splits a text into lower case terms at spaces, punctuation and CamelCase boundaries, so that
+// "WirelessMouse" gives "wireless" and "mouse". Joined words are kept as well, to match "wirelessmouse"
+func Tokenize(text string) []string {
+	tokens := make([]string, 0)
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		parts := splitCamelCase(word)
+		for _, p := range parts {
+			tokens = append(tokens, strings.ToLower(p))
+		}
+
+		if len(parts) > 1 {
+			tokens = append(tokens, strings.ToLower(word))
+		}
+	}
+
+	return tokens
+}
+
+// splitCamelCase splits "LEDMonitor15" into "LED", "Monitor" and "15"
+func splitCamelCase(word string) []string {
+	runes := []rune(word)
+	parts := make([]string, 0)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		prev, cur := runes[i-1], runes[i]
+		boundary := (unicode.IsLower(prev) && unicode.IsUpper(cur)) ||
+			(unicode.IsDigit(prev) != unicode.IsDigit(cur)) ||
+			// the last capital of an acronym starts the next word, "LEDMonitor"
+			(unicode.IsUpper(prev) && unicode.IsUpper(cur) && i+1 < len(runes) && unicode.IsLower(runes[i+1]))
+		if boundary {
+			parts = append(parts, string(runes[start:i]))
+			start = i
+		}
+	}
+
+	return append(parts, string(runes[start:]))
+}
+
+func oneDeletions(term string) []string {
+	runes := []rune(term)
+	result := make([]string, 0, len(runes))
+	for i := range runes {
+		result = append(result, string(runes[:i])+string(runes[i+1:]))
+	}
+
+	return result
+}
+
+// withinOneEdit tells whether one insertion, deletion or substitution turns a into b
+func withinOneEdit(a string, b string) bool {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) > len(rb) {
+		ra, rb = rb, ra
+	}
+	if len(rb)-len(ra) > 1 {
+		return false
+	}
+
+	i := 0
+	for i < len(ra) && ra[i] == rb[i] {
+		i++
+	}
+	if i == len(ra) {
+		return true
+	}
+
+	// skip the differing letter in the longer one, or in both when the lengths are the same
+	if len(ra) == len(rb) {
+		return string(ra[i+1:]) == string(rb[i+1:])
+	}
+	return string(ra[i:]) == string(rb[i+1:])
+}
@@ -0,0 +1,181 @@
+package search
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{text: "Wireless Mouse", want: []string{"wireless", "mouse"}},
+		{text: "WirelessMouse", want: []string{"wireless", "mouse", "wirelessmouse"}},
+		{text: "LEDMonitor15", want: []string{"led", "monitor", "15", "ledmonitor15"}},
+		{text: "USB-C cable, 2m", want: []string{"usb", "c", "cable", "2", "m", "2m"}},
+		{text: "iPhone", want: []string{"i", "phone", "iphone"}},
+		{text: "Café Crème", want: []string{"café", "crème"}},
+		{text: "HDMI", want: []string{"hdmi"}},
+		{text: " -- ", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestWithinOneEdit(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want bool
+	}{
+		{a: "mouse", b: "mouse", want: true},
+		{a: "mouse", b: "mose", want: true},   // deletion
+		{a: "mouse", b: "mousse", want: true}, // insertion
+		{a: "mouse", b: "mouze", want: true},  // substitution
+		{a: "mouse", b: "house", want: true},  // first letter
+		{a: "mouse", b: "mous", want: true},   // last letter
+		{a: "mouse", b: "muose", want: false}, // transposition is two edits
+		{a: "mouse", b: "mose!!", want: false},
+		{a: "mouse", b: "mo", want: false},
+		{a: "café", b: "cafe", want: true}, // letters, not bytes
+		{a: "", b: "a", want: true},
+	}
+
+	for _, tt := range tests {
+		if got := withinOneEdit(tt.a, tt.b); got != tt.want {
+			t.Errorf("withinOneEdit(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if got := withinOneEdit(tt.b, tt.a); got != tt.want {
+			t.Errorf("withinOneEdit(%q, %q) = %v, want %v", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func newTestIndex() *Index {
+	idx := NewIndex()
+	idx.Add("P00001", Field{Text: "Wireless Mouse", Weight: 1}, Field{Text: "Electronics", Weight: 0.5})
+	idx.Add("P00002", Field{Text: "Gaming Keyboard", Weight: 1}, Field{Text: "Electronics", Weight: 0.5})
+	idx.Add("P00003", Field{Text: "Mousepad", Weight: 1}, Field{Text: "Accessories", Weight: 0.5})
+	idx.Add("P00004", Field{Text: "Monitor", Weight: 1}, Field{Text: "Electronics", Weight: 0.5})
+	idx.Add("P00005", Field{Text: "Pen", Weight: 1}, Field{Text: "Stationery", Weight: 0.5})
+	return idx
+}
+
+func ids(results []*Result) []string {
+	result := make([]string, 0, len(results))
+	for _, r := range results {
+		result = append(result, r.ID)
+	}
+
+	return result
+}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "exact", query: "keyboard", want: []string{"P00002"}},
+		// the exact match ranks before the prefix match
+		{name: "prefix", query: "mous", want: []string{"P00001", "P00003"}},
+		{name: "prefix of one letter is not matched", query: "m", want: []string{}},
+		{name: "typo", query: "keybord", want: []string{"P00002"}},
+		{name: "typo in a short token is not matched", query: "pan", want: []string{}},
+		{name: "two edits are not matched", query: "keybrod", want: []string{}},
+		// then a prefix of the name outranks an exact category
+		{name: "more tokens rank first", query: "electronics mouse", want: []string{"P00001", "P00003", "P00002",
+			"P00004"}},
+		{name: "name weighs more than the category", query: "monitor electronics", want: []string{"P00004",
+			"P00001", "P00002"}},
+		{name: "camel case query", query: "GamingKeyboard", want: []string{"P00002"}},
+		{name: "no match", query: "printer", want: []string{}},
+	}
+
+	idx := newTestIndex()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ids(idx.Search(tt.query)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchTiesInIDOrder(t *testing.T) {
+	idx := NewIndex()
+	for _, id := range []string{"P100000", "P99999", "P00002", "P100001"} {
+		idx.Add(id, Field{Text: "Cable", Weight: 1})
+	}
+
+	want := []string{"P00002", "P99999", "P100000", "P100001"}
+	if got := ids(idx.Search("cable")); !reflect.DeepEqual(got, want) {
+		t.Errorf("Search() = %v, want %v", got, want)
+	}
+}
+
+func TestIndexRemove(t *testing.T) {
+	idx := newTestIndex()
+
+	idx.Remove("P00002")
+	if got := ids(idx.Search("keyboard")); len(got) != 0 {
+		t.Errorf("Search() after the remove = %v, want none", got)
+	}
+	if got := ids(idx.Search("keybord")); len(got) != 0 {
+		t.Errorf("Search() with a typo after the remove = %v, want none", got)
+	}
+	if _, ok := idx.postings["keyboard"]; ok {
+		t.Error("the removed document left its term in the postings")
+	}
+	if slices.Contains(idx.terms, "keyboard") || slices.Contains(idx.terms, "gaming") {
+		t.Errorf("the removed document left its terms in the sorted terms: %v", idx.terms)
+	}
+	for _, d := range oneDeletions("keyboard") {
+		if slices.Contains(idx.deletes[d], "keyboard") {
+			t.Errorf("the removed document left its term in the deletions of %q", d)
+		}
+	}
+	// the terms still used by the other documents stay
+	if got := ids(idx.Search("electronics")); !reflect.DeepEqual(got, []string{"P00001", "P00004"}) {
+		t.Errorf("Search() of a shared term = %v, want [P00001 P00004]", got)
+	}
+
+	// adding the id again replaces the document
+	idx.Add("P00001", Field{Text: "Trackball", Weight: 1})
+	if got := ids(idx.Search("wireless")); len(got) != 0 {
+		t.Errorf("Search() of the replaced text = %v, want none", got)
+	}
+	if got := ids(idx.Search("trackbal")); !reflect.DeepEqual(got, []string{"P00001"}) {
+		t.Errorf("Search() of the new text = %v, want [P00001]", got)
+	}
+}
+
+func TestTypoCandidates(t *testing.T) {
+	idx := NewIndex()
+	idx.Add("P00001", Field{Text: "cable mouse", Weight: 1})
+
+	tests := []struct {
+		token string
+		want  string // a term among the candidates
+	}{
+		{token: "cabl", want: "cable"},   // insertion, the token is a deletion of the term
+		{token: "cables", want: "cable"}, // deletion, the term is a deletion of the token
+		{token: "cabke", want: "cable"},  // substitution, both share a deletion
+	}
+
+	for _, tt := range tests {
+		if got := idx.typoCandidates(tt.token); !slices.Contains(got, tt.want) {
+			t.Errorf("typoCandidates(%q) = %v, want %s among them", tt.token, got, tt.want)
+		}
+	}
+
+	if got := idx.deletes["cble"]; !reflect.DeepEqual(got, []string{"cable"}) {
+		t.Errorf("deletions of cble = %v, want [cable]", got)
+	}
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"OnlieStore/internal/model"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CartManager keeps a cart per user. Carts are short-lived, so they are kept in memory only
+type CartManager struct {
+	mu    sync.RWMutex
+	carts map[string]*model.Cart // key - user id, value - cart
+}
+
+func NewCartManager() *CartManager {
+	return &CartManager{
+		carts: make(map[string]*model.Cart),
+	}
+}
+
+func (cm *CartManager) GetCart(userID string) *model.Cart {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	c, ok := cm.carts[userID]
+	if !ok {
+		return &model.Cart{UserID: userID, Items: []*model.CartItem{}}
+	}
+
+	return copyCart(c)
+}
+
+// AddItem adds the quantity to the cart, on top of the quantity already in the cart for the product and sku
+func (cm *CartManager) AddItem(userID string, productID string, sku string, quantity int) *model.Cart {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	c := cm.getOrCreateCart(userID)
+	item := findCartItem(c, productID, sku)
+	if item == nil {
+		c.Items = append(c.Items, &model.CartItem{ProductID: productID, SKU: sku, Quantity: quantity})
+	} else {
+		item.Quantity += quantity
+	}
+
+	c.UpdatedAt = time.Now().UTC()
+	return copyCart(c)
+}
+
+// UpdateItem sets the quantity of a product already in the cart, the product is removed when quantity is 0
+func (cm *CartManager) UpdateItem(userID string, productID string, sku string, quantity int) (*model.Cart,
+	error) {
+	if quantity == 0 {
+		return cm.RemoveItem(userID, productID, sku)
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	c := cm.getOrCreateCart(userID)
+	item := findCartItem(c, productID, sku)
+	if item == nil {
+		return nil, errors.New(fmt.Sprintf("Product is not in the cart, id: %s", productID))
+	}
+
+	item.Quantity = quantity
+	c.UpdatedAt = time.Now().UTC()
+	return copyCart(c), nil
+}
+
+func (cm *CartManager) RemoveItem(userID string, productID string, sku string) (*model.Cart, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	c := cm.getOrCreateCart(userID)
+	for i, item := range c.Items {
+		if item.ProductID == productID && item.SKU == sku {
+			c.Items = append(c.Items[:i], c.Items[i+1:]...)
+			c.UpdatedAt = time.Now().UTC()
+			return copyCart(c), nil
+		}
+	}
+
+	return nil, errors.New(fmt.Sprintf("Product is not in the cart, id: %s", productID))
+}
+
+// TakeCart removes the cart of the user and returns it, so that the same cart can not be checked out twice
+func (cm *CartManager) TakeCart(userID string) *model.Cart {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	c, ok := cm.carts[userID]
+	if !ok {
+		return &model.Cart{UserID: userID, Items: []*model.CartItem{}}
+	}
+
+	delete(cm.carts, userID)
+	return c
+}
+
+// RestoreCart puts back the items of a cart taken by TakeCart, merging them with any items added meanwhile
+func (cm *CartManager) RestoreCart(cart *model.Cart) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	c := cm.getOrCreateCart(cart.UserID)
+	for _, restored := range cart.Items {
+		item := findCartItem(c, restored.ProductID, restored.SKU)
+		if item == nil {
+			c.Items = append(c.Items, restored)
+		} else {
+			item.Quantity += restored.Quantity
+		}
+	}
+
+	c.UpdatedAt = time.Now().UTC()
+}
+
+func (cm *CartManager) getOrCreateCart(userID string) *model.Cart {
+	c, ok := cm.carts[userID]
+	if !ok {
+		c = &model.Cart{UserID: userID, Items: []*model.CartItem{}}
+		cm.carts[userID] = c
+	}
+
+	return c
+}
+
+func findCartItem(c *model.Cart, productID string, sku string) *model.CartItem {
+	for _, item := range c.Items {
+		if item.ProductID == productID && item.SKU == sku {
+			return item
+		}
+	}
+
+	return nil
+}
+
+// copyCart returns a copy, so that the callers can not change the cart outside the lock
+func copyCart(c *model.Cart) *model.Cart {
+	result := &model.Cart{
+		UserID:    c.UserID,
+		Items:     make([]*model.CartItem, 0, len(c.Items)),
+		UpdatedAt: c.UpdatedAt,
+	}
+
+	for _, item := range c.Items {
+		result.Items = append(result.Items, &model.CartItem{ProductID: item.ProductID, SKU: item.SKU,
+			Quantity: item.Quantity})
+	}
+
+	return result
+}
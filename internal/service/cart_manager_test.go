@@ -0,0 +1,140 @@
+package service
+
+import (
+	"OnlieStore/internal/model"
+	"reflect"
+	"testing"
+)
+
+func TestCartManager(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(cm *CartManager) error
+		want    []*model.CartItem
+		wantErr bool
+	}{
+		{
+			name:   "add merges the same product and sku",
+			change: func(cm *CartManager) error { cm.AddItem("U00001", "P00001", "", 3); return nil },
+			want: []*model.CartItem{
+				{ProductID: "P00001", Quantity: 5},
+				{ProductID: "P00002", SKU: "TS-L", Quantity: 1},
+			},
+		},
+		{
+			name:   "add another variant",
+			change: func(cm *CartManager) error { cm.AddItem("U00001", "P00002", "TS-S", 1); return nil },
+			want: []*model.CartItem{
+				{ProductID: "P00001", Quantity: 2},
+				{ProductID: "P00002", SKU: "TS-L", Quantity: 1},
+				{ProductID: "P00002", SKU: "TS-S", Quantity: 1},
+			},
+		},
+		{
+			name: "update sets the quantity",
+			change: func(cm *CartManager) error {
+				_, err := cm.UpdateItem("U00001", "P00002", "TS-L", 4)
+				return err
+			},
+			want: []*model.CartItem{
+				{ProductID: "P00001", Quantity: 2},
+				{ProductID: "P00002", SKU: "TS-L", Quantity: 4},
+			},
+		},
+		{
+			name: "update to zero removes the item",
+			change: func(cm *CartManager) error {
+				_, err := cm.UpdateItem("U00001", "P00001", "", 0)
+				return err
+			},
+			want: []*model.CartItem{{ProductID: "P00002", SKU: "TS-L", Quantity: 1}},
+		},
+		{
+			name: "update of an item not in the cart",
+			change: func(cm *CartManager) error {
+				_, err := cm.UpdateItem("U00001", "P00002", "TS-S", 1)
+				return err
+			},
+			want: []*model.CartItem{
+				{ProductID: "P00001", Quantity: 2},
+				{ProductID: "P00002", SKU: "TS-L", Quantity: 1},
+			},
+			wantErr: true,
+		},
+		{
+			name: "remove",
+			change: func(cm *CartManager) error {
+				_, err := cm.RemoveItem("U00001", "P00002", "TS-L")
+				return err
+			},
+			want: []*model.CartItem{{ProductID: "P00001", Quantity: 2}},
+		},
+		{
+			name: "remove of an item not in the cart",
+			change: func(cm *CartManager) error {
+				_, err := cm.RemoveItem("U00001", "P00003", "")
+				return err
+			},
+			want: []*model.CartItem{
+				{ProductID: "P00001", Quantity: 2},
+				{ProductID: "P00002", SKU: "TS-L", Quantity: 1},
+			},
+			wantErr: true,
+		},
+		{
+			name: "restore merges with the items added after the take",
+			change: func(cm *CartManager) error {
+				cart := cm.TakeCart("U00001")
+				cm.AddItem("U00001", "P00001", "", 1)
+				cm.AddItem("U00001", "P00003", "", 1)
+				cm.RestoreCart(cart)
+				return nil
+			},
+			want: []*model.CartItem{
+				{ProductID: "P00001", Quantity: 3},
+				{ProductID: "P00003", Quantity: 1},
+				{ProductID: "P00002", SKU: "TS-L", Quantity: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := NewCartManager()
+			cm.AddItem("U00001", "P00001", "", 2)
+			cm.AddItem("U00001", "P00002", "TS-L", 1)
+			cm.AddItem("U00002", "P00001", "", 7) // another user, never changed
+
+			err := tt.change(cm)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want an error: %v", err, tt.wantErr)
+			}
+
+			if got := cm.GetCart("U00001").Items; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("items = %+v, want %+v", got, tt.want)
+			}
+			if got := cm.GetCart("U00002").Items; len(got) != 1 || got[0].Quantity != 7 {
+				t.Errorf("items of the other user = %+v, want 7 x P00001", got)
+			}
+		})
+	}
+}
+
+func TestCartManagerTakeCart(t *testing.T) {
+	cm := NewCartManager()
+	cm.AddItem("U00001", "P00001", "", 2)
+
+	// the returned cart is a copy, changing it does not change the cart
+	cm.GetCart("U00001").Items[0].Quantity = 10
+
+	cart := cm.TakeCart("U00001")
+	if len(cart.Items) != 1 || cart.Items[0].Quantity != 2 {
+		t.Errorf("taken items = %+v, want 2 x P00001", cart.Items)
+	}
+	if got := cm.GetCart("U00001").Items; len(got) != 0 {
+		t.Errorf("items after the take = %+v, want none", got)
+	}
+	if got := cm.TakeCart("U00001").Items; len(got) != 0 {
+		t.Errorf("items of a second take = %+v, want none", got)
+	}
+}
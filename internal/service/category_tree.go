@@ -0,0 +1,243 @@
+package service
+
+import (
+	"OnlieStore/internal/idgen"
+	"OnlieStore/internal/model"
+	"OnlieStore/internal/repository"
+	"OnlieStore/internal/util"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+var ErrCategoryNotFound = errors.New("Category not found")
+var ErrCategoryExists = errors.New("Category already exists")
+var ErrInvalidSlug = errors.New("Invalid slug, use lower case letters and digits joined by -")
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// CategoryTree keeps the categories with their hierarchy. Categories are looked up by id, slug or name, names
+// are compared by their slug so that "Home Decor", "home decor" and "HomeDecor" are the same category
+type CategoryTree struct {
+	mu         sync.RWMutex
+	repo       repository.CategoryRepository
+	ids        idgen.Generator
+	categories map[string]*model.Category   // key - category id
+	bySlug     map[string]*model.Category   // key - slug of the category, and the slug of its name
+	children   map[string][]*model.Category // key - parent id, "" for the top level. Sorted by name
+}
+
+func NewCategoryTree(repo repository.CategoryRepository, ids idgen.Generator) *CategoryTree {
+	return &CategoryTree{
+		repo:       repo,
+		ids:        ids,
+		categories: make(map[string]*model.Category),
+		bySlug:     make(map[string]*model.Category),
+		children:   make(map[string][]*model.Category),
+	}
+}
+
+// Load fills the tree with the categories saved in the repository, returns the number of categories loaded
+func (ct *CategoryTree) Load() (int, error) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	categories, err := ct.repo.GetAllCategories()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, c := range categories {
+		ct.add(c)
+		ct.ids.Observe(util.CategoryPrefix, c.ID)
+	}
+
+	return len(categories), nil
+}
+
+// AddCategory adds a category under its parent, the parent has to be added first
+func (ct *CategoryTree) AddCategory(input *model.CategoryDetails) (*model.Category, error) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	slug := input.Slug
+	if slug == "" {
+		slug = Slugify(input.Name)
+	}
+
+	if !slugPattern.MatchString(slug) {
+		return nil, fmt.Errorf("%w, slug: %s", ErrInvalidSlug, slug)
+	}
+
+	for _, s := range []string{slug, Slugify(input.Name)} {
+		if _, ok := ct.bySlug[s]; ok {
+			return nil, fmt.Errorf("%w, slug: %s", ErrCategoryExists, s)
+		}
+	}
+
+	id := input.ID
+	if id == "" {
+		id = ct.newID()
+	} else {
+		err := idgen.Validate(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := ct.categories[id]; ok {
+			return nil, fmt.Errorf("%w, id: %s", idgen.ErrIDExists, id)
+		}
+		ct.ids.Observe(util.CategoryPrefix, id)
+	}
+
+	category := &model.Category{
+		ID:   id,
+		Slug: slug,
+		Name: input.Name,
+	}
+
+	if input.Parent != "" {
+		parent, err := ct.resolve(input.Parent)
+		if err != nil {
+			return nil, err
+		}
+		category.ParentID = parent.ID
+	}
+
+	err := ct.repo.SaveCategory(category)
+	if err != nil {
+		return nil, err
+	}
+
+	ct.add(category)
+	return category, nil
+}
+
+// newID returns an id no category has, must be called with the lock held
+func (ct *CategoryTree) newID() string {
+	for {
+		id := ct.ids.NewID(util.CategoryPrefix)
+		if _, ok := ct.categories[id]; !ok {
+			return id
+		}
+		ct.ids.Observe(util.CategoryPrefix, id)
+	}
+}
+
+// add puts the category into the lookups, must be called with the lock held
+func (ct *CategoryTree) add(c *model.Category) {
+	ct.categories[c.ID] = c
+	ct.bySlug[c.Slug] = c
+	if nameSlug := Slugify(c.Name); nameSlug != "" {
+		if _, ok := ct.bySlug[nameSlug]; !ok {
+			ct.bySlug[nameSlug] = c
+		}
+	}
+
+	siblings := append(ct.children[c.ParentID], c)
+	sort.SliceStable(siblings, func(i, j int) bool {
+		return strings.ToLower(siblings[i].Name) < strings.ToLower(siblings[j].Name)
+	})
+	ct.children[c.ParentID] = siblings
+}
+
+func (ct *CategoryTree) GetCategory(id string) (*model.Category, error) {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+
+	c, ok := ct.categories[id]
+	if !ok {
+		return nil, fmt.Errorf("%w, id: %s", ErrCategoryNotFound, id)
+	}
+
+	return c, nil
+}
+
+// Resolve finds a category by its id, slug or name
+func (ct *CategoryTree) Resolve(ref string) (*model.Category, error) {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+
+	return ct.resolve(ref)
+}
+
+// resolve must be called with the lock held
+func (ct *CategoryTree) resolve(ref string) (*model.Category, error) {
+	ref = strings.TrimSpace(ref)
+	if c, ok := ct.categories[ref]; ok {
+		return c, nil
+	}
+	if c, ok := ct.categories[strings.ToUpper(ref)]; ok {
+		return c, nil
+	}
+
+	if c, ok := ct.bySlug[Slugify(ref)]; ok {
+		return c, nil
+	}
+
+	return nil, fmt.Errorf("%w, category: %s", ErrCategoryNotFound, ref)
+}
+
+// Descendants returns the ids of the category and of all the categories under it
+func (ct *CategoryTree) Descendants(id string) []string {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+
+	result := []string{id}
+	for i := 0; i < len(result); i++ {
+		for _, child := range ct.children[result[i]] {
+			result = append(result, child.ID)
+		}
+	}
+
+	return result
+}
+
+// Tree returns the top level categories with their sub categories. counts are the products per category id,
+// the count of a node includes the products of its sub categories
+func (ct *CategoryTree) Tree(counts map[string]int) []*model.CategoryNode {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+
+	return ct.nodes("", counts)
+}
+
+// nodes builds the sub trees under the parent, must be called with the lock held
+func (ct *CategoryTree) nodes(parentID string, counts map[string]int) []*model.CategoryNode {
+	result := make([]*model.CategoryNode, 0, len(ct.children[parentID]))
+	for _, c := range ct.children[parentID] {
+		node := &model.CategoryNode{Category: c, ProductCount: counts[c.ID], Children: ct.nodes(c.ID, counts)}
+		for _, child := range node.Children {
+			node.ProductCount += child.ProductCount
+		}
+
+		result = append(result, node)
+	}
+
+	return result
+}
+
+// Slugify turns a category name into its slug, words are split at spaces, punctuation and CamelCase boundaries.
+// "Home Decor" and "HomeDecor" both give "home-decor"
+func Slugify(name string) string {
+	words := make([]string, 0)
+	for _, field := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		start := 0
+		runes := []rune(field)
+		for i := 1; i < len(runes); i++ {
+			if unicode.IsLower(runes[i-1]) && unicode.IsUpper(runes[i]) {
+				words = append(words, strings.ToLower(string(runes[start:i])))
+				start = i
+			}
+		}
+		words = append(words, strings.ToLower(string(runes[start:])))
+	}
+
+	return strings.Join(words, "-")
+}
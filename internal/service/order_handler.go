@@ -1,36 +1,87 @@
 package service
 
 import (
+	"OnlieStore/internal/idgen"
 	"OnlieStore/internal/model"
+	"OnlieStore/internal/repository"
 	"OnlieStore/internal/util"
 	"container/list"
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
 )
 
+var ErrOrderNotFound = errors.New("Order not found")
+
 type OrderService struct {
 	mu             sync.RWMutex
+	repo           repository.OrderRepository
+	ids            idgen.Generator
 	orders         map[string]*model.Order
 	ordersByUserID map[string]*list.List
-	latestOrderId  int
 }
 
-func NewOrderService() *OrderService {
+func NewOrderService(repo repository.OrderRepository, ids idgen.Generator) *OrderService {
 	return &OrderService{
+		repo:           repo,
+		ids:            ids,
 		orders:         make(map[string]*model.Order),
 		ordersByUserID: make(map[string]*list.List),
-		latestOrderId:  1,
 	}
 }
 
-func (os *OrderService) AddOrder(order *model.Order) {
+// Load fills the service with the orders saved in the repository, returns the number of orders loaded
+func (os *OrderService) Load() (int, error) {
 	os.mu.Lock()
 	defer os.mu.Unlock()
 
-	order.ID = fmt.Sprintf("%05d", os.latestOrderId)
-	order.Status = string(util.OrderStatusPlaced)
+	orders, err := os.repo.GetAllOrders()
+	if err != nil {
+		return 0, err
+	}
+
+	// the per-user lists are kept in the order the orders were placed, which is the order of their ids
+	sort.Slice(orders, func(i, j int) bool { return idgen.Compare(orders[i].ID, orders[j].ID) < 0 })
+	for _, o := range orders {
+		os.addToIndex(o)
+		os.ids.Observe(util.OrderPrefix, o.ID)
+	}
+
+	return len(orders), nil
+}
+
+func (os *OrderService) AddOrder(order *model.Order) error {
+	os.mu.Lock()
+	defer os.mu.Unlock()
+
+	err := order.Place()
+	if err != nil {
+		return err
+	}
+
+	order.ID = os.newID()
+	err = os.repo.SaveOrder(order)
+	if err != nil {
+		return err
+	}
+
+	os.addToIndex(order)
+	return nil
+}
 
+// newID returns an id no order has, must be called with the lock held
+func (os *OrderService) newID() string {
+	for {
+		id := os.ids.NewID(util.OrderPrefix)
+		if _, ok := os.orders[id]; !ok {
+			return id
+		}
+		os.ids.Observe(util.OrderPrefix, id)
+	}
+}
+
+func (os *OrderService) addToIndex(order *model.Order) {
 	os.orders[order.ID] = order
 
 	if os.ordersByUserID[order.UserID] == nil {
@@ -39,7 +90,6 @@ func (os *OrderService) AddOrder(order *model.Order) {
 
 	// append the latest order to the front, so that can retrieve the latest order first
 	os.ordersByUserID[order.UserID].PushFront(order)
-	os.latestOrderId++
 }
 
 func (os *OrderService) GetOrder(id string) (*model.Order, error) {
@@ -48,51 +98,128 @@ func (os *OrderService) GetOrder(id string) (*model.Order, error) {
 
 	o, ok := os.orders[id]
 	if !ok {
-		return nil, errors.New(fmt.Sprintf("Order not found, id: %s", id))
+		return nil, fmt.Errorf("%w, id: %s", ErrOrderNotFound, id)
 	}
 
 	return o, nil
 }
 
-func (os *OrderService) GetOrdersByUserID(userID string, params *model.PaginationParams) ([]*model.Order, error) {
+// GetOrdersByUserID returns a page of the orders of the user which match the filter, newest first. With a cursor
+// the page starts after the order of the cursor, so the orders placed meanwhile do not shift the pages
+func (os *OrderService) GetOrdersByUserID(userID string, params *model.PaginationParams,
+	filter *model.OrderFilter) (*model.OrderPage, error) {
+	if params.Limit <= 0 {
+		return nil, errors.New(fmt.Sprintf("Invalid limit for get orders request, limit : %d", params.Limit))
+	}
+
+	startIndex := 0
+	if params.Cursor == nil {
+		startIndex = (params.Page - 1) * params.Limit
+		if startIndex < 0 {
+			return nil, errors.New(fmt.Sprintf("Invalid page number for get orders request, page : %d",
+				params.Page))
+		}
+	}
+
 	os.mu.RLock()
 	defer os.mu.RUnlock()
 
+	page := &model.OrderPage{Data: []*model.Order{}}
 	orderList, ok := os.ordersByUserID[userID]
 	if !ok {
-		return []*model.Order{}, nil
+		return page, nil
 	}
 
-	startIndex := (params.Page - 1) * params.Limit
-	endIndex := startIndex + params.Limit
-	if endIndex >= orderList.Len() {
-		endIndex = orderList.Len() - 1
-	}
-	if startIndex < 0 {
-		return []*model.Order{}, errors.New(fmt.Sprintf("Invalid page number for get orders request, page : %d",
-			params.Page))
+	// list has the latest order at the front. Orders are never removed, so the order of the cursor is always
+	// found, even when it does not match the filter anymore
+	passedCursor := params.Cursor == nil
+	skipped, hasMore := 0, false
+	for e := orderList.Front(); e != nil; e = e.Next() {
+		o := e.Value.(*model.Order)
+		if !passedCursor {
+			passedCursor = o.ID == params.Cursor.ID
+			if filter.Matches(o) {
+				page.Total++
+			}
+			continue
+		}
+
+		if !filter.Matches(o) {
+			continue
+		}
+		page.Total++
+
+		if skipped < startIndex {
+			skipped++
+		} else if len(page.Data) < params.Limit {
+			page.Data = append(page.Data, o)
+		} else {
+			hasMore = true
+		}
 	}
 
-	result := make([]*model.Order, 0)
-	i := 0
-	for e := orderList.Front(); e != nil && i <= endIndex; e = e.Next() {
-		if i >= startIndex {
-			result = append(result, e.Value.(*model.Order))
+	if hasMore {
+		page.Next = &model.Cursor{ID: page.Data[len(page.Data)-1].ID}
+		if params.Cursor == nil {
+			page.NextPage = params.Page + 1
 		}
-		i++
 	}
 
-	return result, nil
+	return page, nil
 }
 
-func (os *OrderService) UpdateOrderStatus(id string, status util.OrderStatus) error {
+// ReleaseFunc puts the units of the items of an order back to the store, persisting them with save
+type ReleaseFunc func(items []*model.OrderItem, orderID string, save SaveStockFunc) error
+
+// UpdateOrderStatus moves the order to the status. When the move puts the units of the order back to the store,
+// release does it and the order is saved with the released stock in one repository operation. So the order only
+// becomes cancelled or failed together with its restock, and stays as it was when either fails
+func (os *OrderService) UpdateOrderStatus(id string, status util.OrderStatus, changedBy string,
+	release ReleaseFunc) error {
 	os.mu.Lock()
 	defer os.mu.Unlock()
 
 	o, ok := os.orders[id]
 	if !ok {
-		return errors.New(fmt.Sprintf("Order not found, id: %s", id))
+		return fmt.Errorf("%w, id: %s", ErrOrderNotFound, id)
+	}
+
+	previousStatus, previousHistory := o.Status, o.History
+	releases := util.ReleasesStock(util.OrderStatus(o.Status), status)
+	err := o.UpdateOrderStatus(status, changedBy)
+	if err != nil {
+		return err
+	}
+
+	if releases {
+		err = release(o.Items, o.ID, func(stocks []*model.Stock, entries []*model.StockLedgerEntry) error {
+			return os.repo.SaveOrderRelease(o, stocks, entries)
+		})
+	} else {
+		err = os.repo.SaveOrder(o)
+	}
+	if err != nil {
+		// keep the service in line with the repository
+		o.Status, o.History = previousStatus, previousHistory
+		return err
+	}
+
+	return nil
+}
+
+// CountOrdersByStatus returns the number of orders in each status
+func (os *OrderService) CountOrdersByStatus() map[string]int {
+	os.mu.RLock()
+	defer os.mu.RUnlock()
+
+	result := make(map[string]int)
+	for _, s := range util.OrderStatuses {
+		result[string(s)] = 0
+	}
+
+	for _, o := range os.orders {
+		result[o.Status]++
 	}
 
-	return o.UpdateOrderStatus(status)
+	return result
 }
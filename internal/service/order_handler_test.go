@@ -0,0 +1,104 @@
+package service
+
+import (
+	"OnlieStore/internal/idgen"
+	"OnlieStore/internal/model"
+	"OnlieStore/internal/repository"
+	"OnlieStore/internal/util"
+	"errors"
+	"testing"
+)
+
+var errSaveFailed = errors.New("save failed")
+
+// failingReleaseRepository fails to save the orders which release their stock
+type failingReleaseRepository struct {
+	*repository.MemoryOrderRepository
+}
+
+func (r *failingReleaseRepository) SaveOrderRelease(*model.Order, []*model.Stock, []*model.StockLedgerEntry) error {
+	return errSaveFailed
+}
+
+func TestUpdateOrderStatusReleasesStock(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       []util.OrderStatus // statuses before the last one
+		status     util.OrderStatus
+		failSave   bool
+		wantStatus util.OrderStatus
+		wantQty    int
+	}{
+		{name: "cancelled", status: util.OrderStatusCancelled, wantStatus: util.OrderStatusCancelled, wantQty: 10},
+		{
+			name:       "confirmed then failed",
+			path:       []util.OrderStatus{util.OrderStatusConfirmed},
+			status:     util.OrderStatusError,
+			wantStatus: util.OrderStatusError,
+			wantQty:    10,
+		},
+		{
+			name:       "shipped then failed",
+			path:       []util.OrderStatus{util.OrderStatusConfirmed, util.OrderStatusShipped},
+			status:     util.OrderStatusError,
+			wantStatus: util.OrderStatusError,
+			wantQty:    7,
+		},
+		{
+			name:       "save fails",
+			status:     util.OrderStatusCancelled,
+			failSave:   true,
+			wantStatus: util.OrderStatusPlaced,
+			wantQty:    7,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := newTestProductStore(t)
+			product := &model.ProductDetails{Name: "WirelessMouse", Price: testPrice(t, "19.99"),
+				Category: "electronics", AddedQuantity: 10}
+			err := ps.AddProduct(product)
+			if err != nil {
+				t.Fatalf("failed to add the product: %v", err)
+			}
+
+			var repo repository.OrderRepository = repository.NewMemoryOrderRepository(
+				repository.NewMemoryProductRepository())
+			if tt.failSave {
+				repo = &failingReleaseRepository{repository.NewMemoryOrderRepository(nil)}
+			}
+			os := NewOrderService(repo, idgen.NewSequence())
+
+			order := &model.Order{UserID: "U1001",
+				Items: []*model.OrderItem{{ProductID: product.ID, Quantity: 3}}}
+			err = ps.ReserveProducts(order.Items)
+			if err != nil {
+				t.Fatalf("failed to reserve: %v", err)
+			}
+			err = os.AddOrder(order)
+			if err != nil {
+				t.Fatalf("failed to add the order: %v", err)
+			}
+
+			for _, s := range tt.path {
+				err = os.UpdateOrderStatus(order.ID, s, "U1002", ps.ReleaseProducts)
+				if err != nil {
+					t.Fatalf("failed to move the order to %s: %v", s, err)
+				}
+			}
+
+			err = os.UpdateOrderStatus(order.ID, tt.status, "U1002", ps.ReleaseProducts)
+			if tt.failSave != errors.Is(err, errSaveFailed) {
+				t.Fatalf("UpdateOrderStatus() error = %v, want the save to fail: %v", err, tt.failSave)
+			}
+
+			if got := util.OrderStatus(order.Status); got != tt.wantStatus {
+				t.Errorf("status = %s, want %s", got, tt.wantStatus)
+			}
+			if got := ps.GetStockLevels()[product.ID]; got != tt.wantQty {
+				t.Errorf("quantity = %d, want %d", got, tt.wantQty)
+			}
+		})
+	}
+}
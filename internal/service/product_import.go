@@ -0,0 +1,365 @@
+package service
+
+import (
+	"OnlieStore/internal/idgen"
+	"OnlieStore/internal/model"
+	"OnlieStore/internal/money"
+	"OnlieStore/internal/util"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"time"
+)
+
+// productImport is the state of a bulk import while its rows are checked. Products are changed on copies, the
+// copies replace the products in the store only when all the rows are valid
+type productImport struct {
+	store    *ProductStore
+	report   *model.ImportReport
+	stocks   []*model.Stock          // copies of the existing products and the new products, in row order
+	copies   map[string]*model.Stock // key - product id, value - copy of the product
+	byName   map[string]*model.Stock // key - lower case name, products with variants which new variants join
+	dirty    map[*model.Stock]bool   // products the rows change
+	firstRow map[*model.Stock]int    // row which gave the name, price and category of the product
+	skuRows  map[string]int          // key - sku, value - row of the sku
+	idRows   map[string]int          // key - product id, value - row of a product without variants
+	names    map[string][]string     // key - lower case name, value - ids of the products in the store
+	nameRows map[string]int          // key - lower case name, value - row of a new product without variants
+	entries  []*importEntry
+}
+
+// importEntry is a ledger entry of the import, the product id is set on save, when the new products get theirs
+type importEntry struct {
+	stock *model.Stock
+	entry *model.StockLedgerEntry
+}
+
+// ImportProducts adds or updates the products of the rows, filling in the report. Variants are matched by their
+// SKU. Products without variants are matched by their id, or by their name when the row has no id, so that an
+// export without the ids can be imported again. A new variant without the id of its product joins the product
+// with variants of the same name in the import, or makes a new product. Quantities are the current quantities to
+// set, the changes are recorded in the stock ledger, the quantities of the new products too. Nothing is changed
+// when the report has any error, or on a dry run
+func (ps *ProductStore) ImportProducts(rows []*model.ProductRow, report *model.ImportReport) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	imp := &productImport{
+		store:    ps,
+		report:   report,
+		copies:   make(map[string]*model.Stock),
+		byName:   make(map[string]*model.Stock),
+		dirty:    make(map[*model.Stock]bool),
+		firstRow: make(map[*model.Stock]int),
+		skuRows:  make(map[string]int),
+		idRows:   make(map[string]int),
+		names:    make(map[string][]string),
+		nameRows: make(map[string]int),
+	}
+
+	for _, s := range ps.stockList {
+		key := strings.ToLower(s.Product.Name)
+		imp.names[key] = append(imp.names[key], s.ID)
+	}
+
+	// the products of the known SKUs first, so that new variants find them whatever the order of the rows is
+	for _, row := range rows {
+		if id, ok := ps.skus[row.SKU]; ok && row.SKU != "" {
+			key := strings.ToLower(row.Name)
+			if _, ok := imp.byName[key]; !ok {
+				imp.byName[key], _, _ = imp.copyOf(id)
+			}
+		}
+	}
+
+	for _, row := range rows {
+		imp.importRow(row)
+	}
+
+	if len(report.Errors) > 0 || report.DryRun {
+		return nil
+	}
+
+	return imp.save()
+}
+
+func (imp *productImport) importRow(row *model.ProductRow) {
+	category, err := imp.store.categories.Resolve(row.Category)
+	if err != nil {
+		imp.report.AddIssue(row.Row, "category", err.Error())
+		return
+	}
+
+	s, field, reason := imp.findProduct(row)
+	if reason != "" {
+		imp.report.AddIssue(row.Row, field, reason)
+		return
+	}
+
+	isNew := s.ID == ""
+	if s.Product.IsDeleted() {
+		imp.report.AddIssue(row.Row, "id", fmt.Sprintf("Product %s is deleted", s.ID))
+		return
+	}
+
+	changed := false
+	if first, ok := imp.firstRow[s]; ok {
+		// the rows of the variants repeat the fields of the product, they have to agree
+		field := ""
+		switch {
+		case s.Product.Name != row.Name:
+			field = "name"
+		case !s.Product.Price.Equal(row.Price):
+			field = "price"
+		case s.Product.CategoryID != category.ID:
+			field = "category"
+		}
+		if field != "" {
+			imp.report.AddIssue(row.Row, field, fmt.Sprintf("Differs from row %d of the same product", first))
+			return
+		}
+	} else {
+		imp.firstRow[s] = row.Row
+		changed = s.Product.Name != row.Name || !s.Product.Price.Equal(row.Price) ||
+			s.Product.CategoryID != category.ID
+		s.Product.Name, s.Product.Price = row.Name, row.Price
+		s.Product.Category, s.Product.CategoryID = category.Name, category.ID
+	}
+
+	var v *model.Variant
+	if row.SKU == "" {
+		if s.HasVariants() {
+			imp.report.AddIssue(row.Row, "sku", fmt.Sprintf("Product %s has variants, a sku is required", s.ID))
+			return
+		}
+	} else {
+		v = s.FindVariant(row.SKU)
+		if v == nil {
+			if !isNew && !s.HasVariants() {
+				imp.report.AddIssue(row.Row, "sku", fmt.Sprintf("Product %s has no variants", s.ID))
+				return
+			}
+
+			v = &model.Variant{SKU: row.SKU}
+			s.Variants = append(s.Variants, v)
+			isNew = true
+		}
+
+		changed = changed || !maps.Equal(v.Attributes, row.Attributes) || !samePrice(v.Price, row.VariantPrice)
+		v.Attributes, v.Price = row.Attributes, row.VariantPrice
+	}
+
+	current := s.CurrentQuantity
+	if v != nil {
+		current = v.CurrentQuantity
+	}
+
+	// the same as a restock when units are added, and as a sale when they are taken out
+	change := row.Quantity - current
+	changeQuantities(s, v, max(change, 0), change)
+	if change != 0 {
+		imp.entries = append(imp.entries, &importEntry{stock: s, entry: &model.StockLedgerEntry{
+			SKU:       row.SKU,
+			Change:    change,
+			Reason:    util.StockReasonImport,
+			CreatedAt: time.Now().UTC(),
+		}})
+	}
+
+	switch {
+	case isNew:
+		imp.report.Created++
+	case changed || change != 0:
+		imp.report.Updated++
+	default:
+		imp.report.Unchanged++
+		return
+	}
+	imp.dirty[s] = true
+}
+
+// findProduct returns the copy of the product the row belongs to, or a new product. Otherwise the field and the
+// reason the row is refused
+func (imp *productImport) findProduct(row *model.ProductRow) (*model.Stock, string, string) {
+	if row.SKU == "" {
+		id := row.ID
+		if id == "" {
+			key := strings.ToLower(row.Name)
+			if first, ok := imp.nameRows[key]; ok {
+				return nil, "name", fmt.Sprintf("Product %s is already on row %d", row.Name, first)
+			}
+			imp.nameRows[key] = row.Row
+
+			switch ids := imp.names[key]; len(ids) {
+			case 0:
+				return imp.newProduct(), "", ""
+			case 1:
+				id = ids[0]
+			default:
+				return nil, "id", fmt.Sprintf("%d products are named %s, the id is required", len(ids), row.Name)
+			}
+		}
+
+		if first, ok := imp.idRows[id]; ok {
+			return nil, "id", fmt.Sprintf("Product %s is already on row %d", id, first)
+		}
+		imp.idRows[id] = row.Row
+
+		return imp.copyOf(id)
+	}
+
+	if first, ok := imp.skuRows[row.SKU]; ok {
+		return nil, "sku", fmt.Sprintf("SKU %s is already on row %d", row.SKU, first)
+	}
+	imp.skuRows[row.SKU] = row.Row
+
+	if id, ok := imp.store.skus[row.SKU]; ok {
+		if row.ID != "" && row.ID != id {
+			return nil, "id", fmt.Sprintf("SKU %s belongs to product %s", row.SKU, id)
+		}
+		return imp.copyOf(id)
+	}
+
+	if row.ID != "" {
+		return imp.copyOf(row.ID)
+	}
+
+	key := strings.ToLower(row.Name)
+	s, ok := imp.byName[key]
+	if !ok {
+		s = imp.newProduct()
+		imp.byName[key] = s
+	}
+
+	return s, "", ""
+}
+
+func (imp *productImport) copyOf(id string) (*model.Stock, string, string) {
+	if s, ok := imp.copies[id]; ok {
+		return s, "", ""
+	}
+
+	s, ok := imp.store.stock[id]
+	if !ok {
+		return nil, "id", fmt.Sprintf("Unknown product : %s", id)
+	}
+
+	product := *s.Product
+	c := *s
+	c.Product = &product
+	c.Variants = nil
+	for _, v := range s.Variants {
+		variant := *v
+		c.Variants = append(c.Variants, &variant)
+	}
+
+	imp.copies[id] = &c
+	imp.stocks = append(imp.stocks, &c)
+	return &c, "", ""
+}
+
+// newProduct starts a product which gets its id when the import is saved
+func (imp *productImport) newProduct() *model.Stock {
+	s := &model.Stock{Product: &model.Product{}}
+	imp.stocks = append(imp.stocks, s)
+	return s
+}
+
+// save assigns the ids of the new products, saves the changed products and puts them into the store
+func (imp *productImport) save() error {
+	ps := imp.store
+	changed := make([]*model.Stock, 0, len(imp.dirty))
+	for _, s := range imp.stocks {
+		if !imp.dirty[s] {
+			continue
+		}
+
+		if s.ID == "" {
+			s.ID = ps.newID()
+			s.Product.ID = s.ID
+		}
+		changed = append(changed, s)
+	}
+
+	if len(changed) == 0 {
+		return nil
+	}
+
+	entries := make([]*model.StockLedgerEntry, 0, len(imp.entries))
+	for _, e := range imp.entries {
+		e.entry.ProductID = e.stock.ID
+		entries = append(entries, e.entry)
+	}
+
+	err := ps.repo.SaveStockMovements(changed, entries)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range changed {
+		ps.stock[s.ID] = s
+		for _, v := range s.Variants {
+			ps.skus[v.SKU] = s.ID
+		}
+		ps.indexForSearch(s.Product)
+	}
+
+	// a new list, the copies replace the products and the pages handed out keep the old one
+	stockList := make([]*model.Stock, 0, len(ps.stock))
+	for _, s := range ps.stock {
+		if !s.Product.IsDeleted() {
+			stockList = append(stockList, s)
+		}
+	}
+	sort.Slice(stockList, func(i, j int) bool { return idgen.Compare(stockList[i].ID, stockList[j].ID) < 0 })
+	ps.stockList = stockList
+	ps.reindex()
+
+	return nil
+}
+
+// samePrice compares the prices of variants, nil when the variant sells at the price of the product
+func samePrice(a *money.Money, b *money.Money) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// ExportProducts returns the rows of the products in the catalog, which ImportProducts reads back. Categories
+// are given by their slug
+func (ps *ProductStore) ExportProducts() []*model.ProductRow {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	result := make([]*model.ProductRow, 0, len(ps.stockList))
+	for _, s := range ps.stockList {
+		category := s.Product.Category
+		if c, err := ps.categories.GetCategory(s.Product.CategoryID); err == nil {
+			category = c.Slug
+		}
+
+		row := &model.ProductRow{
+			ID:       s.ID,
+			Name:     s.Product.Name,
+			Price:    s.Product.Price,
+			Category: category,
+			Quantity: s.CurrentQuantity,
+		}
+
+		if !s.HasVariants() {
+			result = append(result, row)
+			continue
+		}
+
+		for _, v := range s.Variants {
+			variantRow := *row
+			variantRow.SKU, variantRow.Attributes, variantRow.VariantPrice = v.SKU, v.Attributes, v.Price
+			variantRow.Quantity = v.CurrentQuantity
+			result = append(result, &variantRow)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"OnlieStore/internal/idgen"
+	"OnlieStore/internal/model"
+	"OnlieStore/internal/repository"
+	"OnlieStore/internal/util"
+	"reflect"
+	"testing"
+)
+
+// ledgerRepository keeps the ledger entries the product store saves
+type ledgerRepository struct {
+	*repository.MemoryProductRepository
+	entries []*model.StockLedgerEntry
+}
+
+func (r *ledgerRepository) SaveStockMovements(stocks []*model.Stock, entries []*model.StockLedgerEntry) error {
+	r.entries = append(r.entries, entries...)
+	return r.MemoryProductRepository.SaveStockMovements(stocks, entries)
+}
+
+// newImportTestStore returns a store with a mouse, P00001, and a t-shirt with two variants, P00002
+func newImportTestStore(t *testing.T) (*ProductStore, *ledgerRepository) {
+	t.Helper()
+
+	ids := idgen.NewSequence()
+	categories := NewCategoryTree(repository.NewMemoryCategoryRepository(), ids)
+	_, err := categories.AddCategory(&model.CategoryDetails{Name: "Electronics"})
+	if err != nil {
+		t.Fatalf("failed to add the category: %v", err)
+	}
+
+	repo := &ledgerRepository{MemoryProductRepository: repository.NewMemoryProductRepository()}
+	ps := NewProductStore(repo, categories, ids)
+	products := []*model.ProductDetails{
+		{Name: "Mouse", Price: testPrice(t, "19.99"), Category: "electronics", AddedQuantity: 10},
+		{Name: "T-Shirt", Price: testPrice(t, "9.99"), Category: "electronics", Variants: []*model.VariantDetails{
+			{SKU: "TS-S", Attributes: map[string]string{"size": "S"}, AddedQuantity: 3},
+			{SKU: "TS-L", Attributes: map[string]string{"size": "L"}, AddedQuantity: 4},
+		}},
+	}
+	for _, p := range products {
+		err = ps.AddProduct(p)
+		if err != nil {
+			t.Fatalf("failed to add the product: %v", err)
+		}
+	}
+
+	return ps, repo
+}
+
+// ledgerEntry is the part of a ledger entry the tests compare
+type ledgerEntry struct {
+	ProductID string
+	SKU       string
+	Change    int
+}
+
+func TestImportProducts(t *testing.T) {
+	tests := []struct {
+		name       string
+		rows       []*model.ProductRow
+		want       model.ImportReport
+		wantLedger []ledgerEntry
+		wantLevels map[string]int // key - product id, value - current quantity
+	}{
+		{
+			name:       "new product",
+			rows:       []*model.ProductRow{{Row: 2, Name: "Keyboard", Category: "electronics", Quantity: 5}},
+			want:       model.ImportReport{Rows: 1, Created: 1},
+			wantLedger: []ledgerEntry{{ProductID: "P00003", Change: 5}},
+			wantLevels: map[string]int{"P00001": 10, "P00002": 7, "P00003": 5},
+		},
+		{
+			name: "new product with variants",
+			rows: []*model.ProductRow{
+				{Row: 2, SKU: "CAP-RED", Name: "Cap", Category: "electronics", Quantity: 2},
+				{Row: 3, SKU: "CAP-BLUE", Name: "Cap", Category: "electronics", Quantity: 1},
+			},
+			want: model.ImportReport{Rows: 2, Created: 2},
+			wantLedger: []ledgerEntry{
+				{ProductID: "P00003", SKU: "CAP-RED", Change: 2},
+				{ProductID: "P00003", SKU: "CAP-BLUE", Change: 1},
+			},
+			wantLevels: map[string]int{"P00001": 10, "P00002": 7, "P00003": 3},
+		},
+		{
+			name:       "new product without stock",
+			rows:       []*model.ProductRow{{Row: 2, Name: "Keyboard", Category: "electronics"}},
+			want:       model.ImportReport{Rows: 1, Created: 1},
+			wantLevels: map[string]int{"P00001": 10, "P00002": 7, "P00003": 0},
+		},
+		{
+			name: "matched by id",
+			rows: []*model.ProductRow{
+				{Row: 2, ID: "P00001", Name: "Gaming Mouse", Category: "electronics", Quantity: 8},
+			},
+			want:       model.ImportReport{Rows: 1, Updated: 1},
+			wantLedger: []ledgerEntry{{ProductID: "P00001", Change: -2}},
+			wantLevels: map[string]int{"P00001": 8, "P00002": 7},
+		},
+		{
+			name:       "matched by name without an id",
+			rows:       []*model.ProductRow{{Row: 2, Name: "MOUSE", Category: "electronics", Quantity: 12}},
+			want:       model.ImportReport{Rows: 1, Updated: 1},
+			wantLedger: []ledgerEntry{{ProductID: "P00001", Change: 2}},
+			wantLevels: map[string]int{"P00001": 12, "P00002": 7},
+		},
+		{
+			name: "variant matched by sku",
+			rows: []*model.ProductRow{
+				{Row: 2, SKU: "TS-L", Name: "T-Shirt", Category: "electronics", Quantity: 1,
+					Attributes: map[string]string{"size": "L"}},
+			},
+			want:       model.ImportReport{Rows: 1, Updated: 1},
+			wantLedger: []ledgerEntry{{ProductID: "P00002", SKU: "TS-L", Change: -3}},
+			wantLevels: map[string]int{"P00001": 10, "P00002": 4},
+		},
+		{
+			name: "same name twice",
+			rows: []*model.ProductRow{
+				{Row: 2, Name: "Keyboard", Category: "electronics", Quantity: 5},
+				{Row: 3, Name: "keyboard", Category: "electronics", Quantity: 6},
+			},
+			want: model.ImportReport{Rows: 2, Created: 1,
+				Errors: []*model.ImportIssue{{Row: 3, Field: "name", Reason: "Product keyboard is already on row 2"}}},
+			wantLevels: map[string]int{"P00001": 10, "P00002": 7},
+		},
+		{
+			name: "id and name of the same product",
+			rows: []*model.ProductRow{
+				{Row: 2, ID: "P00001", Name: "Mouse", Category: "electronics", Quantity: 5},
+				{Row: 3, Name: "Mouse", Category: "electronics", Quantity: 6},
+			},
+			want: model.ImportReport{Rows: 2, Updated: 1,
+				Errors: []*model.ImportIssue{{Row: 3, Field: "id", Reason: "Product P00001 is already on row 2"}}},
+			wantLevels: map[string]int{"P00001": 10, "P00002": 7},
+		},
+		{
+			name: "name of a product with variants",
+			rows: []*model.ProductRow{{Row: 2, Name: "T-Shirt", Category: "electronics", Quantity: 5}},
+			want: model.ImportReport{Rows: 1, Errors: []*model.ImportIssue{
+				{Row: 2, Field: "sku", Reason: "Product P00002 has variants, a sku is required"},
+			}},
+			wantLevels: map[string]int{"P00001": 10, "P00002": 7},
+		},
+		{
+			name: "an invalid row stops the whole import",
+			rows: []*model.ProductRow{
+				{Row: 2, Name: "Keyboard", Category: "electronics", Quantity: 5},
+				{Row: 3, ID: "P00001", Name: "Mouse", Category: "electronics", Quantity: 1},
+				{Row: 4, ID: "P00404", Name: "Monitor", Category: "electronics", Quantity: 1},
+			},
+			want: model.ImportReport{Rows: 3, Created: 1, Updated: 1,
+				Errors: []*model.ImportIssue{{Row: 4, Field: "id", Reason: "Unknown product : P00404"}}},
+			wantLevels: map[string]int{"P00001": 10, "P00002": 7},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps, repo := newImportTestStore(t)
+			repo.entries = nil
+
+			report := &model.ImportReport{Rows: len(tt.rows)}
+			err := ps.ImportProducts(tt.rows, report)
+			if err != nil {
+				t.Fatalf("ImportProducts() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(*report, tt.want) {
+				t.Errorf("report = %+v, want %+v", *report, tt.want)
+				for _, issue := range report.Errors {
+					t.Logf("error = %+v", *issue)
+				}
+			}
+
+			ledger := make([]ledgerEntry, 0)
+			for _, e := range repo.entries {
+				if e.Reason != util.StockReasonImport {
+					t.Errorf("reason of %+v = %s, want %s", e, e.Reason, util.StockReasonImport)
+				}
+				ledger = append(ledger, ledgerEntry{ProductID: e.ProductID, SKU: e.SKU, Change: e.Change})
+			}
+			if len(ledger) != 0 || len(tt.wantLedger) != 0 {
+				if !reflect.DeepEqual(ledger, tt.wantLedger) {
+					t.Errorf("ledger = %+v, want %+v", ledger, tt.wantLedger)
+				}
+			}
+
+			if got := ps.GetStockLevels(); !reflect.DeepEqual(got, tt.wantLevels) {
+				t.Errorf("stock levels = %v, want %v", got, tt.wantLevels)
+			}
+		})
+	}
+}
+
+func TestImportProductsAmbiguousName(t *testing.T) {
+	ps, _ := newImportTestStore(t)
+	err := ps.AddProduct(&model.ProductDetails{Name: "mouse", Price: testPrice(t, "5.00"), Category: "electronics"})
+	if err != nil {
+		t.Fatalf("failed to add the product: %v", err)
+	}
+
+	report := &model.ImportReport{Rows: 1}
+	err = ps.ImportProducts([]*model.ProductRow{{Row: 2, Name: "Mouse", Category: "electronics", Quantity: 1}}, report)
+	if err != nil {
+		t.Fatalf("ImportProducts() error = %v", err)
+	}
+
+	want := []*model.ImportIssue{{Row: 2, Field: "id", Reason: "2 products are named Mouse, the id is required"}}
+	if !reflect.DeepEqual(report.Errors, want) {
+		t.Errorf("errors = %+v, want %+v", report.Errors, want)
+	}
+}
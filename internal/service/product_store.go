@@ -1,101 +1,800 @@
 package service
 
 import (
+	"OnlieStore/internal/idgen"
 	"OnlieStore/internal/model"
+	"OnlieStore/internal/repository"
+	"OnlieStore/internal/search"
 	"OnlieStore/internal/util"
+	"cmp"
 	"errors"
 	"fmt"
+	"github.com/sirupsen/logrus"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
+var ErrInsufficientStock = errors.New("Product is not available in the store to buy")
+var ErrPriceMismatch = errors.New("Product price has changed")
+var ErrProductNotFound = errors.New("Product not found")
+var ErrSKUExists = errors.New("SKU is already used")
+
 type ProductStore struct {
-	mu              sync.RWMutex
-	stock           map[string]*model.Stock // key - product id, value - product stock
-	latestProdIndex int                     // next available index to be used as the product id when adding new product
-	stockList       []*model.Stock          // sorted list of products
+	mu         sync.RWMutex
+	repo       repository.ProductRepository
+	categories *CategoryTree
+	ids        idgen.Generator
+	stock      map[string]*model.Stock // key - product id, value - product stock
+	stockList  []*model.Stock          // sorted list of products, deleted products are left out
+	skus       map[string]string       // key - variant sku, value - product id. SKUs of deleted products stay
+
+	// secondary indexes over stockList, rebuilt when the catalog changes
+	byCategory map[string][]*model.Stock // key - category id, products sorted by id
+	byPrice    []*model.Stock            // sorted by price, then id
+	byName     []*model.Stock            // sorted by lower case name, then id
+
+	searchIndex *search.Index // full text index over the name and the category, deleted products are left out
 }
 
-func NewProductStore() *ProductStore {
+func NewProductStore(repo repository.ProductRepository, categories *CategoryTree, ids idgen.Generator) *ProductStore {
 	return &ProductStore{
-		stock:           make(map[string]*model.Stock),
-		stockList:       make([]*model.Stock, 0),
-		latestProdIndex: 1,
+		repo:        repo,
+		categories:  categories,
+		ids:         ids,
+		stock:       make(map[string]*model.Stock),
+		stockList:   make([]*model.Stock, 0),
+		skus:        make(map[string]string),
+		byCategory:  make(map[string][]*model.Stock),
+		searchIndex: search.NewIndex(),
 	}
 }
 
-func (ps *ProductStore) AddProduct(input *model.ProductDetails) {
+// Load fills the store with the stock saved in the repository, returns the number of products loaded.
+// The categories have to be loaded first
+func (ps *ProductStore) Load() (int, error) {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 
+	stockList, err := ps.repo.GetAllStock()
+	if err != nil {
+		return 0, err
+	}
+
+	err = ps.assignCategories(stockList)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, s := range stockList {
+		ps.stock[s.ID] = s
+		ps.ids.Observe(util.ProductPrefix, s.ID)
+		for _, v := range s.Variants {
+			ps.skus[v.SKU] = s.ID
+		}
+		if !s.Product.IsDeleted() {
+			ps.stockList = append(ps.stockList, s)
+			ps.indexForSearch(s.Product)
+		}
+	}
+
+	// repository returns the products sorted by id
+	ps.reindex()
+	return len(stockList), nil
+}
+
+// assignCategories fills in the category id of the products saved before the categories, by the name of their
+// category. Products whose category is not known are left without an id and are not listed under any category
+func (ps *ProductStore) assignCategories(stockList []*model.Stock) error {
+	changed := make([]*model.Stock, 0)
+	for _, s := range stockList {
+		if s.Product.CategoryID != "" {
+			continue
+		}
+
+		category, err := ps.categories.Resolve(s.Product.Category)
+		if err != nil {
+			logrus.WithError(err).WithField("product_id", s.ID).Warn("Product has an unknown category")
+			continue
+		}
+
+		s.Product.CategoryID, s.Product.Category = category.ID, category.Name
+		changed = append(changed, s)
+	}
+
+	if len(changed) == 0 {
+		return nil
+	}
+
+	logrus.WithField("count", len(changed)).Info("Assigned the categories of the products")
+	return ps.repo.SaveStocks(changed)
+}
+
+// AddProduct adds the product under an existing category, given by its id, slug or name. The id of the input is
+// kept when it is given, e.g. by the data file, otherwise a new id is set on the input
+func (ps *ProductStore) AddProduct(input *model.ProductDetails) error {
+	category, err := ps.categories.Resolve(input.Category)
+	if err != nil {
+		return err
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	id := input.ID
+	if id == "" {
+		id = ps.newID()
+	} else if err := ps.checkID(id); err != nil {
+		return err
+	}
+
 	productStock := &model.Stock{
-		ID: fmt.Sprintf("%s%05d", util.ProductSuffix, ps.latestProdIndex),
+		ID: id,
 		Product: &model.Product{
-			ID:       fmt.Sprintf("%s%05d", util.ProductSuffix, ps.latestProdIndex),
-			Name:     input.Name,
-			Price:    input.Price,
-			Category: input.Category,
+			ID:         id,
+			Name:       input.Name,
+			Price:      input.Price,
+			Category:   category.Name,
+			CategoryID: category.ID,
 		},
 		InitialQuantity: input.AddedQuantity,
 		CurrentQuantity: input.AddedQuantity,
 	}
 
+	if len(input.Variants) > 0 {
+		variants, err := ps.newVariants(input.Variants)
+		if err != nil {
+			return err
+		}
+
+		// the quantities of the product are the totals of its variants
+		productStock.Variants, productStock.InitialQuantity, productStock.CurrentQuantity = variants, 0, 0
+		for _, v := range variants {
+			productStock.InitialQuantity += v.InitialQuantity
+			productStock.CurrentQuantity += v.CurrentQuantity
+		}
+	}
+
+	err = ps.repo.SaveStock(productStock)
+	if err != nil {
+		return err
+	}
+
 	ps.stock[productStock.ID] = productStock
+	for _, v := range productStock.Variants {
+		ps.skus[v.SKU] = productStock.ID
+	}
 	ps.stockList = append(ps.stockList, productStock)
 
 	// sort the list when a new product is added
 	sort.Slice(
 		ps.stockList,
 		func(i, j int) bool {
-			return ps.stockList[i].ID < ps.stockList[j].ID
+			return idgen.Compare(ps.stockList[i].ID, ps.stockList[j].ID) < 0
+		})
+
+	ps.reindex()
+	ps.indexForSearch(productStock.Product)
+	input.ID = productStock.ID
+	return nil
+}
+
+// newID returns an id no product has, must be called with the lock held
+func (ps *ProductStore) newID() string {
+	for {
+		id := ps.ids.NewID(util.ProductPrefix)
+		if _, ok := ps.stock[id]; !ok {
+			return id
+		}
+		ps.ids.Observe(util.ProductPrefix, id)
+	}
+}
+
+// checkID checks an id given with a new product, must be called with the lock held
+func (ps *ProductStore) checkID(id string) error {
+	err := idgen.Validate(id)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ps.stock[id]; ok {
+		return fmt.Errorf("%w, id: %s", idgen.ErrIDExists, id)
+	}
+
+	ps.ids.Observe(util.ProductPrefix, id)
+	return nil
+}
+
+// newVariants checks that the SKUs are not used by any other variant, must be called with the lock held
+func (ps *ProductStore) newVariants(input []*model.VariantDetails) ([]*model.Variant, error) {
+	seen := make(map[string]bool)
+	variants := make([]*model.Variant, 0, len(input))
+	for _, v := range input {
+		if _, ok := ps.skus[v.SKU]; ok || seen[v.SKU] {
+			return nil, fmt.Errorf("%w, sku: %s", ErrSKUExists, v.SKU)
+		}
+		seen[v.SKU] = true
+
+		variants = append(variants, &model.Variant{
+			SKU:             v.SKU,
+			Attributes:      v.Attributes,
+			Price:           v.Price,
+			InitialQuantity: v.AddedQuantity,
+			CurrentQuantity: v.AddedQuantity,
 		})
+	}
+
+	return variants, nil
+}
+
+// ProductIDForSKU returns the product a variant belongs to
+func (ps *ProductStore) ProductIDForSKU(sku string) (string, error) {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	id, ok := ps.skus[sku]
+	if !ok {
+		return "", fmt.Errorf("%w, sku: %s", ErrProductNotFound, sku)
+	}
 
-	ps.latestProdIndex++
+	return id, nil
 }
 
+// GetProduct returns the product even when it is deleted, so that the past orders can still show it
 func (ps *ProductStore) GetProduct(id string) (*model.Stock, error) {
 	ps.mu.RLock()
 	defer ps.mu.RUnlock()
 
 	p, ok := ps.stock[id]
 	if !ok {
-		return nil, errors.New(fmt.Sprintf("Product not found, id: %s", id))
+		return nil, fmt.Errorf("%w, id: %s", ErrProductNotFound, id)
 	}
 
 	return p, nil
 }
 
-func (ps *ProductStore) IsProductAvailableToBuy(id string, quantity int) bool {
+// getActiveProduct returns a product which is not deleted, must be called with the lock held
+func (ps *ProductStore) getActiveProduct(id string) (*model.Stock, error) {
+	p, ok := ps.stock[id]
+	if !ok || p.Product.IsDeleted() {
+		return nil, fmt.Errorf("%w, id: %s", ErrProductNotFound, id)
+	}
+
+	return p, nil
+}
+
+// UpdateProduct changes the name, price and category of a product. Orders keep the price they were placed with
+func (ps *ProductStore) UpdateProduct(id string, update *model.ProductUpdate) (*model.Stock, error) {
+	var category *model.Category
+	if update.Category != nil {
+		var err error
+		category, err = ps.categories.Resolve(*update.Category)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	p, err := ps.getActiveProduct(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// the product is replaced instead of changed, readers holding the old one are not affected
+	previous := p.Product
+	updated := *previous
+	if update.Name != nil {
+		updated.Name = *update.Name
+	}
+	if update.Price != nil {
+		updated.Price = *update.Price
+	}
+	if category != nil {
+		updated.Category, updated.CategoryID = category.Name, category.ID
+	}
+
+	p.Product = &updated
+	err = ps.repo.SaveStock(p)
+	if err != nil {
+		// keep the store in line with the repository
+		p.Product = previous
+		return nil, err
+	}
+
+	ps.reindex()
+	ps.indexForSearch(p.Product)
+	return p, nil
+}
+
+// DeleteProduct hides the product from the listings and stops the sales. The product stays in the store, so
+// that the orders which refer to it can still be resolved
+func (ps *ProductStore) DeleteProduct(id string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	p, err := ps.getActiveProduct(id)
+	if err != nil {
+		return err
+	}
+
+	previous := p.Product
+	deleted := *previous
+	deletedAt := time.Now().UTC()
+	deleted.DeletedAt = &deletedAt
+
+	p.Product = &deleted
+	err = ps.repo.SaveStock(p)
+	if err != nil {
+		// keep the store in line with the repository
+		p.Product = previous
+		return err
+	}
+
+	// a new list, the pages handed out by GetProducts share the old one
+	stockList := make([]*model.Stock, 0, len(ps.stockList))
+	for _, s := range ps.stockList {
+		if s.ID != id {
+			stockList = append(stockList, s)
+		}
+	}
+	ps.stockList = stockList
+	ps.reindex()
+	ps.searchIndex.Remove(id)
+
+	return nil
+}
+
+// GetStockLevels returns the current quantity of each product in the catalog, deleted products are left out
+func (ps *ProductStore) GetStockLevels() map[string]int {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	result := make(map[string]int, len(ps.stock))
+	for id, s := range ps.stock {
+		if s.Product.IsDeleted() {
+			continue
+		}
+		result[id] = s.CurrentQuantity
+	}
+
+	return result
+}
+
+// ReserveProducts checks the availability and takes the quantities of all the items out of the stock as a
+// single step, so that concurrent buyers can not oversell a product. Nothing is reserved when any item fails.
+// Unit price of each item is set from the catalog, the client never decides the price. Items given only by
+// the SKU get the id of the product filled in
+func (ps *ProductStore) ReserveProducts(items []*model.OrderItem) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	// an order can have more than one line for the same product or variant
+	type line struct {
+		stock   *model.Stock
+		variant *model.Variant
+	}
+	required := make(map[line]int)
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return errors.New(fmt.Sprintf("Invalid quantity : %d", item.Quantity))
+		}
+
+		if item.ProductID == "" {
+			item.ProductID = ps.skus[item.SKU]
+		}
+
+		p, v, err := ps.findVariant(item.ProductID, item.SKU)
+		if err != nil {
+			return err
+		}
+
+		price := p.UnitPrice(v)
+		if item.ExpectedPrice != nil && !item.ExpectedPrice.Equal(price) {
+			return fmt.Errorf("%w, id: %s, expected: %s, current: %s", ErrPriceMismatch, item.ProductID,
+				item.ExpectedPrice, price)
+		}
+
+		required[line{stock: p, variant: v}] += item.Quantity
+	}
+
+	changed := make([]*model.Stock, 0, len(required))
+	added := make(map[string]bool)
+	for l, quantity := range required {
+		available := l.stock.CurrentQuantity
+		if l.variant != nil {
+			available = l.variant.CurrentQuantity
+		}
+
+		if available < quantity {
+			return fmt.Errorf("%w, id: %s", ErrInsufficientStock, l.stock.ID)
+		}
+
+		if !added[l.stock.ID] {
+			changed = append(changed, l.stock)
+			added[l.stock.ID] = true
+		}
+	}
+
+	for l, quantity := range required {
+		l.stock.CurrentQuantity -= quantity
+		if l.variant != nil {
+			l.variant.CurrentQuantity -= quantity
+		}
+	}
+
+	for _, item := range items {
+		p, v, _ := ps.findVariant(item.ProductID, item.SKU)
+		item.Price = p.UnitPrice(v)
+	}
+
+	err := ps.repo.SaveStocks(changed)
+	if err != nil {
+		// keep the store in line with the repository
+		for l, quantity := range required {
+			l.stock.CurrentQuantity += quantity
+			if l.variant != nil {
+				l.variant.CurrentQuantity += quantity
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// SaveStockFunc persists the changed stock with the ledger entries of the changes, all or none
+type SaveStockFunc func(stocks []*model.Stock, entries []*model.StockLedgerEntry) error
+
+// ReleaseProducts puts the units of the items back to the store, e.g. of a cancelled order. The changes are
+// persisted by save, which can save them together with the order, and are taken back when it fails. Nothing is
+// released when any item fails
+func (ps *ProductStore) ReleaseProducts(items []*model.OrderItem, orderID string, save SaveStockFunc) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	type line struct {
+		stock    *model.Stock
+		variant  *model.Variant
+		quantity int
+	}
+	lines := make([]line, 0, len(items))
+	for _, item := range items {
+		// deleted products still take their units back, so that the ledger adds up
+		p, ok := ps.stock[item.ProductID]
+		if !ok {
+			return errors.New(fmt.Sprintf("Product %s is not available", item.ProductID))
+		}
+
+		var v *model.Variant
+		if item.SKU != "" {
+			v = p.FindVariant(item.SKU)
+			if v == nil {
+				return errors.New(fmt.Sprintf("Variant %s is not available for product %s", item.SKU,
+					item.ProductID))
+			}
+		}
+
+		lines = append(lines, line{stock: p, variant: v, quantity: item.Quantity})
+	}
+
+	changed := make([]*model.Stock, 0, len(lines))
+	added := make(map[string]bool)
+	entries := make([]*model.StockLedgerEntry, 0, len(lines))
+	for _, l := range lines {
+		// units were never sold, so the initial qty stays the same
+		changeQuantities(l.stock, l.variant, 0, l.quantity)
+		if !added[l.stock.ID] {
+			changed = append(changed, l.stock)
+			added[l.stock.ID] = true
+		}
+
+		entry := &model.StockLedgerEntry{
+			ProductID: l.stock.ID,
+			OrderID:   orderID,
+			Change:    l.quantity,
+			Reason:    util.StockReasonReleased,
+			CreatedAt: time.Now().UTC(),
+		}
+		if l.variant != nil {
+			entry.SKU = l.variant.SKU
+		}
+		entries = append(entries, entry)
+	}
+
+	err := save(changed, entries)
+	if err != nil {
+		// keep the store in line with the repository
+		for _, l := range lines {
+			changeQuantities(l.stock, l.variant, 0, -l.quantity)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ResolveItem checks that the product, or its variant with the sku, can be sold. Returns the product id, which
+// can be left empty when the sku is given
+func (ps *ProductStore) ResolveItem(id string, sku string) (string, error) {
 	ps.mu.RLock()
 	defer ps.mu.RUnlock()
 
-	if p, ok := ps.stock[id]; ok && p.CurrentQuantity >= quantity {
-		return true
+	if id == "" {
+		id = ps.skus[sku]
 	}
 
-	return false
+	_, _, err := ps.findVariant(id, sku)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
 }
 
-func (ps *ProductStore) GetProducts(params *model.PaginationParams) ([]*model.Stock, error) {
+// findVariant returns a product which can be sold, with the variant of the SKU. Products with variants are
+// sold only by SKU. Must be called with the lock held
+func (ps *ProductStore) findVariant(id string, sku string) (*model.Stock, *model.Variant, error) {
+	p, ok := ps.stock[id]
+	if !ok || p.Product.IsDeleted() {
+		return nil, nil, errors.New(fmt.Sprintf("Product %s is not available", id))
+	}
+
+	if !p.HasVariants() {
+		if sku != "" {
+			return nil, nil, errors.New(fmt.Sprintf("Product %s has no variants, sku %s is not valid", id, sku))
+		}
+		return p, nil, nil
+	}
+
+	if sku == "" {
+		return nil, nil, errors.New(fmt.Sprintf("Product %s has variants, a sku is required", id))
+	}
+
+	v := p.FindVariant(sku)
+	if v == nil {
+		return nil, nil, errors.New(fmt.Sprintf("Variant %s is not available for product %s", sku, id))
+	}
+
+	return p, v, nil
+}
+
+// GetProducts returns a page of the products matching the filter. The narrowest index is picked to find the
+// candidates, and the matches are sorted only when the index is not in the requested order already
+func (ps *ProductStore) GetProducts(params *model.PaginationParams, filter *model.ProductFilter) (*model.ProductPage,
+	error) {
+	if params.Limit <= 0 {
+		return nil, errors.New(fmt.Sprintf("Invalid limit received for the request, Limit : %d", params.Limit))
+	}
+
+	var categoryIDs []string
+	if filter.Category != "" {
+		category, err := ps.categories.Resolve(filter.Category)
+		if err != nil {
+			return nil, err
+		}
+		categoryIDs = ps.categories.Descendants(category.ID)
+	}
+
 	ps.mu.RLock()
 	defer ps.mu.RUnlock()
 
-	// product list is in sorted order already
-	startIndex := (params.Page - 1) * params.Limit
+	candidates, order := ps.candidates(filter, categoryIDs)
+	matched := make([]*model.Stock, 0, len(candidates))
+	for _, s := range candidates {
+		if filter.Matches(s) {
+			matched = append(matched, s)
+		}
+	}
+
+	sortProducts(matched, order, filter.Sort)
+
+	var startIndex int
+	if params.Cursor != nil {
+		startIndex = sort.Search(len(matched), func(i int) bool {
+			return isAfterCursor(matched[i], params.Cursor, filter.Sort)
+		})
+	} else {
+		if params.Page <= 0 {
+			return nil, errors.New(fmt.Sprintf("Invalid page number received for the request, Page : %d",
+				params.Page))
+		}
+		startIndex = (params.Page - 1) * params.Limit
+	}
+
+	page := &model.ProductPage{Data: []*model.Stock{}, Total: len(matched)}
+	if startIndex >= len(matched) {
+		return page, nil
+	}
+
 	endIndex := startIndex + params.Limit
+	if endIndex >= len(matched) {
+		page.Data = matched[startIndex:]
+		return page, nil
+	}
 
-	if startIndex < 0 {
-		return nil, errors.New(fmt.Sprintf("Invalid page number received for the request, Page : %d", params.Page))
+	page.Data = matched[startIndex:endIndex]
+	page.Next = productCursor(page.Data[len(page.Data)-1], filter.Sort)
+	if params.Cursor == nil {
+		page.NextPage = params.Page + 1
 	}
+	return page, nil
+}
 
-	if endIndex > len(ps.stockList) {
-		endIndex = len(ps.stockList)
+// productCursor returns the position of the product in a listing with the given sort
+func productCursor(s *model.Stock, sortBy string) *model.Cursor {
+	switch sortBy {
+	case util.ProductSortPrice, util.ProductSortPriceDesc:
+		return &model.Cursor{Key: strconv.FormatInt(s.Product.Price.Amount, 10), ID: s.ID}
+	case util.ProductSortName, util.ProductSortNameDesc:
+		return &model.Cursor{Key: strings.ToLower(s.Product.Name), ID: s.ID}
 	}
 
-	return ps.stockList[startIndex:endIndex], nil
+	return &model.Cursor{ID: s.ID}
 }
 
-func (ps *ProductStore) UpdateProductQuantity(id string, action int, quantity int) error {
+// isAfterCursor tells whether the product comes after the cursor in a listing with the given sort
+func isAfterCursor(s *model.Stock, cursor *model.Cursor, sortBy string) bool {
+	// compare in ascending order of the sort key, then the id
+	result := 0
+	switch sortBy {
+	case util.ProductSortPrice, util.ProductSortPriceDesc:
+		amount, _ := strconv.ParseInt(cursor.Key, 10, 64)
+		result = cmp.Compare(s.Product.Price.Amount, amount)
+	case util.ProductSortName, util.ProductSortNameDesc:
+		result = strings.Compare(strings.ToLower(s.Product.Name), cursor.Key)
+	}
+	if result == 0 {
+		result = idgen.Compare(s.ID, cursor.ID)
+	}
+
+	if sortBy == util.ProductSortPriceDesc || sortBy == util.ProductSortNameDesc || sortBy == util.ProductSortNewest {
+		return result < 0
+	}
+	return result > 0
+}
+
+// candidates returns the products which can match the filter, and the sort order they are in. categoryIDs
+// are the category of the filter with its sub categories, only their products are returned when set
+func (ps *ProductStore) candidates(filter *model.ProductFilter, categoryIDs []string) ([]*model.Stock, string) {
+	if len(categoryIDs) == 1 {
+		return ps.byCategory[categoryIDs[0]], ""
+	}
+
+	if len(categoryIDs) > 1 {
+		result := make([]*model.Stock, 0)
+		for _, id := range categoryIDs {
+			result = append(result, ps.byCategory[id]...)
+		}
+		sort.Slice(result, func(i, j int) bool { return idgen.Compare(result[i].ID, result[j].ID) < 0 })
+		return result, ""
+	}
+
+	if filter.MinPrice != nil || filter.MaxPrice != nil {
+		from, to := 0, len(ps.byPrice)
+		if filter.MinPrice != nil {
+			from = sort.Search(len(ps.byPrice), func(i int) bool {
+				return ps.byPrice[i].Product.Price.Amount >= filter.MinPrice.Amount
+			})
+		}
+		if filter.MaxPrice != nil {
+			to = sort.Search(len(ps.byPrice), func(i int) bool {
+				return ps.byPrice[i].Product.Price.Amount > filter.MaxPrice.Amount
+			})
+		}
+		if from >= to {
+			return nil, ""
+		}
+		return ps.byPrice[from:to], util.ProductSortPrice
+	}
+
+	switch filter.Sort {
+	case util.ProductSortPrice, util.ProductSortPriceDesc:
+		return ps.byPrice, util.ProductSortPrice
+	case util.ProductSortName, util.ProductSortNameDesc:
+		return ps.byName, util.ProductSortName
+	}
+
+	return ps.stockList, ""
+}
+
+// sortProducts puts the products, which are in the given order, into the requested order
+func sortProducts(products []*model.Stock, order string, requested string) {
+	switch requested {
+	case util.ProductSortPrice, util.ProductSortPriceDesc:
+		if order != util.ProductSortPrice {
+			sort.SliceStable(products, func(i, j int) bool { return lessByPrice(products[i], products[j]) })
+		}
+	case util.ProductSortName, util.ProductSortNameDesc:
+		if order != util.ProductSortName {
+			sort.SliceStable(products, func(i, j int) bool { return lessByName(products[i], products[j]) })
+		}
+	default:
+		if order != "" {
+			sort.SliceStable(products, func(i, j int) bool { return idgen.Compare(products[i].ID, products[j].ID) < 0 })
+		}
+	}
+
+	// ids are generated in the order the products are added, so the newest products have the largest ids
+	if requested == util.ProductSortPriceDesc || requested == util.ProductSortNameDesc ||
+		requested == util.ProductSortNewest {
+		slices.Reverse(products)
+	}
+}
+
+func lessByPrice(a *model.Stock, b *model.Stock) bool {
+	if a.Product.Price.Amount != b.Product.Price.Amount {
+		return a.Product.Price.Amount < b.Product.Price.Amount
+	}
+	return idgen.Compare(a.ID, b.ID) < 0
+}
+
+func lessByName(a *model.Stock, b *model.Stock) bool {
+	nameA, nameB := strings.ToLower(a.Product.Name), strings.ToLower(b.Product.Name)
+	if nameA != nameB {
+		return nameA < nameB
+	}
+	return idgen.Compare(a.ID, b.ID) < 0
+}
+
+// SearchProducts ranks the products by how well their name and category match the query. Returns up to limit
+// results with the total number of matches
+func (ps *ProductStore) SearchProducts(query string, limit int) ([]*model.ProductSearchResult, int) {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	matches := ps.searchIndex.Search(query)
+	result := make([]*model.ProductSearchResult, 0, min(limit, len(matches)))
+	for _, m := range matches[:min(limit, len(matches))] {
+		result = append(result, &model.ProductSearchResult{Product: ps.stock[m.ID], Score: m.Score})
+	}
+
+	return result, len(matches)
+}
+
+// indexForSearch adds the product to the full text index, a match on the name counts more than on the category.
+// Must be called with the lock held
+func (ps *ProductStore) indexForSearch(p *model.Product) {
+	ps.searchIndex.Add(p.ID, search.Field{Text: p.Name, Weight: 2}, search.Field{Text: p.Category, Weight: 1})
+}
+
+// reindex rebuilds the secondary indexes from stockList, must be called with the lock held.
+// New slices are made every time, the pages handed out earlier keep pointing to the old ones
+func (ps *ProductStore) reindex() {
+	byCategory := make(map[string][]*model.Stock)
+	for _, s := range ps.stockList {
+		byCategory[s.Product.CategoryID] = append(byCategory[s.Product.CategoryID], s)
+	}
+
+	byPrice := slices.Clone(ps.stockList)
+	sort.SliceStable(byPrice, func(i, j int) bool { return lessByPrice(byPrice[i], byPrice[j]) })
+
+	byName := slices.Clone(ps.stockList)
+	sort.SliceStable(byName, func(i, j int) bool { return lessByName(byName[i], byName[j]) })
+
+	ps.byCategory, ps.byPrice, ps.byName = byCategory, byPrice, byName
+}
+
+// CountByCategory returns the number of products in the catalog per category id, deleted products are left out
+func (ps *ProductStore) CountByCategory() map[string]int {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	result := make(map[string]int, len(ps.byCategory))
+	for id, products := range ps.byCategory {
+		result[id] = len(products)
+	}
+
+	return result
+}
+
+// UpdateProductQuantity changes the quantity of a product, or of its variant with the sku, and records the
+// change in the stock ledger. orderID is the order which caused the change, empty when stock is added by admin
+func (ps *ProductStore) UpdateProductQuantity(id string, sku string, action int, quantity int, orderID string) error {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 
@@ -104,14 +803,62 @@ func (ps *ProductStore) UpdateProductQuantity(id string, action int, quantity in
 		return errors.New(fmt.Sprintf("Product %s is not available", id))
 	}
 
+	// a product with variants keeps the totals of its variants, both are changed together
+	var v *model.Variant
+	if p.HasVariants() && sku == "" {
+		return errors.New(fmt.Sprintf("Product %s has variants, a sku is required", id))
+	}
+	if sku != "" {
+		v = p.FindVariant(sku)
+		if v == nil {
+			return errors.New(fmt.Sprintf("Variant %s is not available for product %s", sku, id))
+		}
+	}
+
+	entry := &model.StockLedgerEntry{
+		ProductID: id,
+		SKU:       sku,
+		OrderID:   orderID,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	initialChange, currentChange := 0, 0
 	if action == util.ActionProductDecrease {
-		p.CurrentQuantity -= quantity // reduce qty because of a user buy action
+		available := p.CurrentQuantity
+		if v != nil {
+			available = v.CurrentQuantity
+		}
+		if available < quantity {
+			return ErrInsufficientStock
+		}
+		currentChange = -quantity // reduce qty because of a user buy action
+		entry.Change, entry.Reason = -quantity, util.StockReasonSale
 	} else if action == util.ActionProductIncrease {
-		p.InitialQuantity += quantity // increase qty after adding new stocks
-		p.CurrentQuantity += quantity
+		if p.Product.IsDeleted() {
+			return fmt.Errorf("%w, id: %s", ErrProductNotFound, id)
+		}
+		initialChange, currentChange = quantity, quantity // increase qty after adding new stocks
+		entry.Change, entry.Reason = quantity, util.StockReasonRestock
 	} else {
 		return errors.New(fmt.Sprintf("Invalid action : %d", action))
 	}
 
+	changeQuantities(p, v, initialChange, currentChange)
+	err := ps.repo.SaveStockMovement(p, entry)
+	if err != nil {
+		// keep the store in line with the repository
+		changeQuantities(p, v, -initialChange, -currentChange)
+		return err
+	}
+
 	return nil
 }
+
+func changeQuantities(p *model.Stock, v *model.Variant, initialChange int, currentChange int) {
+	p.InitialQuantity += initialChange
+	p.CurrentQuantity += currentChange
+	if v != nil {
+		v.InitialQuantity += initialChange
+		v.CurrentQuantity += currentChange
+	}
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"OnlieStore/internal/idgen"
+	"OnlieStore/internal/model"
+	"OnlieStore/internal/money"
+	"OnlieStore/internal/repository"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func newTestProductStore(t *testing.T) *ProductStore {
+	t.Helper()
+
+	ids := idgen.NewSequence()
+	categories := NewCategoryTree(repository.NewMemoryCategoryRepository(), ids)
+	_, err := categories.AddCategory(&model.CategoryDetails{Name: "Electronics"})
+	if err != nil {
+		t.Fatalf("failed to add the category: %v", err)
+	}
+
+	return NewProductStore(repository.NewMemoryProductRepository(), categories, ids)
+}
+
+func testPrice(t *testing.T, value string) money.Money {
+	t.Helper()
+
+	price, err := money.Parse(value, "USD")
+	if err != nil {
+		t.Fatalf("failed to parse the price %s: %v", value, err)
+	}
+
+	return price
+}
+
+// TestReserveProductsConcurrently fires many parallel reservations of one unit at a small stock, exactly as many
+// reservations as there are units have to succeed. Run with -race
+func TestReserveProductsConcurrently(t *testing.T) {
+	const stock = 10
+	const buyers = 500
+
+	tests := []struct {
+		name     string
+		variants []*model.VariantDetails
+		sku      string
+	}{
+		{name: "product"},
+		{
+			name: "variant",
+			variants: []*model.VariantDetails{
+				{SKU: "MOUSE-RED", Attributes: map[string]string{"colour": "red"}, AddedQuantity: stock},
+				{SKU: "MOUSE-BLUE", Attributes: map[string]string{"colour": "blue"}, AddedQuantity: stock},
+			},
+			sku: "MOUSE-RED",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := newTestProductStore(t)
+			product := &model.ProductDetails{
+				Name:          "WirelessMouse",
+				Price:         testPrice(t, "19.99"),
+				Category:      "electronics",
+				AddedQuantity: stock,
+				Variants:      tt.variants,
+			}
+			err := ps.AddProduct(product)
+			if err != nil {
+				t.Fatalf("failed to add the product: %v", err)
+			}
+			initial := ps.GetStockLevels()[product.ID]
+
+			// samples the quantity while the buyers run, it must never be negative
+			done := make(chan struct{})
+			var negative atomic.Bool
+			var sampler sync.WaitGroup
+			sampler.Add(1)
+			go func() {
+				defer sampler.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+						if ps.GetStockLevels()[product.ID] < 0 {
+							negative.Store(true)
+						}
+					}
+				}
+			}()
+
+			var succeeded, insufficient atomic.Int32
+			var wg sync.WaitGroup
+			start := make(chan struct{})
+			for i := 0; i < buyers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+
+					items := []*model.OrderItem{{ProductID: product.ID, SKU: tt.sku, Quantity: 1}}
+					err := ps.ReserveProducts(items)
+					switch {
+					case err == nil:
+						succeeded.Add(1)
+					case errors.Is(err, ErrInsufficientStock):
+						insufficient.Add(1)
+					default:
+						t.Errorf("unexpected error: %v", err)
+					}
+				}()
+			}
+			close(start)
+			wg.Wait()
+			close(done)
+			sampler.Wait()
+
+			if got := succeeded.Load(); got != stock {
+				t.Errorf("succeeded reservations = %d, want %d", got, stock)
+			}
+			if got := insufficient.Load(); got != buyers-stock {
+				t.Errorf("refused reservations = %d, want %d", got, buyers-stock)
+			}
+			if negative.Load() {
+				t.Error("the quantity went below zero")
+			}
+
+			s, err := ps.GetProduct(product.ID)
+			if err != nil {
+				t.Fatalf("failed to get the product: %v", err)
+			}
+			if s.CurrentQuantity != initial-stock {
+				t.Errorf("quantity of the product = %d, want %d", s.CurrentQuantity, initial-stock)
+			}
+			if v := s.FindVariant(tt.sku); v != nil && v.CurrentQuantity != 0 {
+				t.Errorf("quantity of the variant = %d, want 0", v.CurrentQuantity)
+			}
+		})
+	}
+}
+
+func TestGetStockLevelsLeavesOutDeletedProducts(t *testing.T) {
+	ps := newTestProductStore(t)
+	kept := &model.ProductDetails{Name: "WirelessMouse", Price: testPrice(t, "19.99"), Category: "electronics",
+		AddedQuantity: 10}
+	deleted := &model.ProductDetails{Name: "OldKeyboard", Price: testPrice(t, "29.99"), Category: "electronics",
+		AddedQuantity: 4}
+	for _, p := range []*model.ProductDetails{kept, deleted} {
+		err := ps.AddProduct(p)
+		if err != nil {
+			t.Fatalf("failed to add the product: %v", err)
+		}
+	}
+
+	err := ps.DeleteProduct(deleted.ID)
+	if err != nil {
+		t.Fatalf("failed to delete the product: %v", err)
+	}
+
+	levels := ps.GetStockLevels()
+	if _, ok := levels[deleted.ID]; ok {
+		t.Errorf("stock levels include the deleted product %s", deleted.ID)
+	}
+	if got := levels[kept.ID]; got != 10 {
+		t.Errorf("quantity of %s = %d, want 10", kept.ID, got)
+	}
+}
@@ -1,24 +1,40 @@
 package service
 
 import (
+	"OnlieStore/internal/auth"
+	"OnlieStore/internal/idgen"
 	"OnlieStore/internal/model"
+	"OnlieStore/internal/repository"
 	"OnlieStore/internal/util"
 	"errors"
 	"fmt"
+	"github.com/sirupsen/logrus"
 	"sync"
 )
 
+var ErrUserExists = errors.New("User name is already taken")
+var ErrWrongPassword = errors.New("Current password is incorrect")
+
+// ErrInvalidCredentials is returned for both unknown users and wrong passwords, so that the login does not
+// tell which users exist
+var ErrInvalidCredentials = errors.New("Invalid username or password")
+
 type UserManager struct {
-	mu              sync.RWMutex
-	users           map[string]*model.User // key - user id, value - user
-	usersByName     map[string]*model.User // key - user name, value - user
-	latestUserIndex int
+	mu           sync.RWMutex
+	repo         repository.UserRepository
+	ids          idgen.Generator
+	users        map[string]*model.User // key - user id, value - user
+	usersByName  map[string]*model.User // key - user name, value - user
+	passwordCost int                    // bcrypt cost for new hashes
 }
 
-func NewUserManager() *UserManager {
+func NewUserManager(repo repository.UserRepository, ids idgen.Generator, passwordCost int) *UserManager {
 	return &UserManager{
-		users:       make(map[string]*model.User),
-		usersByName: make(map[string]*model.User),
+		repo:         repo,
+		ids:          ids,
+		users:        make(map[string]*model.User),
+		usersByName:  make(map[string]*model.User),
+		passwordCost: passwordCost,
 	}
 }
 
@@ -34,31 +50,218 @@ func (um *UserManager) GetUser(id string) (*model.User, error) {
 	return u, nil
 }
 
+// Load fills the manager with the users saved in the repository, returns the number of users loaded
+func (um *UserManager) Load() (int, error) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	users, err := um.repo.GetAllUsers()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, u := range users {
+		// rows saved before passwords were hashed still hold the plaintext password
+		if !auth.IsPasswordHash(u.PasswordHash) {
+			u.PasswordHash, err = auth.HashPassword(u.PasswordHash, um.passwordCost)
+			if err != nil {
+				return 0, err
+			}
+
+			err = um.repo.SaveUser(u)
+			if err != nil {
+				return 0, err
+			}
+
+			logrus.WithField("user_id", u.ID).Info("Hashed the plaintext password of the user")
+		}
+
+		um.users[u.ID] = u
+		um.usersByName[u.Name] = u
+		um.ids.Observe(util.UserPrefix, u.ID)
+	}
+
+	return len(users), nil
+}
+
+// AddUser keeps the id of the user when it is given, e.g. by the data file, otherwise a new id is set
 func (um *UserManager) AddUser(u *model.User) error {
 	um.mu.Lock()
 	defer um.mu.Unlock()
 
-	u.ID = fmt.Sprintf("%s05%d", util.UserSuffix, um.latestUserIndex)
+	if _, ok := um.usersByName[u.Name]; ok {
+		return fmt.Errorf("%w, username: %s", ErrUserExists, u.Name)
+	}
+
+	if u.ID == "" {
+		u.ID = um.newID()
+	} else {
+		err := idgen.Validate(u.ID)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := um.users[u.ID]; ok {
+			return fmt.Errorf("%w, id: %s", idgen.ErrIDExists, u.ID)
+		}
+		um.ids.Observe(util.UserPrefix, u.ID)
+	}
+
+	err := um.repo.SaveUser(u)
+	if err != nil {
+		return err
+	}
 
 	um.users[u.ID] = u
 	um.usersByName[u.Name] = u
-
-	um.latestUserIndex++
 	return nil
 }
 
+// newID returns an id no user has, must be called with the lock held
+func (um *UserManager) newID() string {
+	for {
+		id := um.ids.NewID(util.UserPrefix)
+		if _, ok := um.users[id]; !ok {
+			return id
+		}
+		um.ids.Observe(util.UserPrefix, id)
+	}
+}
+
 func (um *UserManager) ValidateAndGetUser(userName string, password string) (*model.User, error) {
 	um.mu.RLock()
-	defer um.mu.RUnlock()
-
 	u, ok := um.usersByName[userName]
+	var hash string
+	if ok {
+		hash = u.PasswordHash
+	}
+	um.mu.RUnlock()
+
+	// hashing is slow, so the comparison is done outside the lock
 	if !ok {
-		return nil, errors.New(fmt.Sprintf("User not found, username: %s", userName))
+		auth.VerifyDummyPassword(password)
+		return nil, ErrInvalidCredentials
+	}
+
+	if !auth.VerifyPassword(hash, password) {
+		return nil, ErrInvalidCredentials
 	}
 
-	if u.Password != password {
-		return nil, errors.New(fmt.Sprintf("Invalid password, username: %s", userName))
+	if auth.NeedsRehash(hash, um.passwordCost) {
+		um.rehashPassword(u, hash, password)
 	}
 
 	return u, nil
 }
+
+// rehashPassword replaces a hash made with an old cost, the login still succeeds when this fails
+func (um *UserManager) rehashPassword(u *model.User, oldHash string, password string) {
+	newHash, err := auth.HashPassword(password, um.passwordCost)
+	if err != nil {
+		logrus.WithError(err).WithField("user_id", u.ID).Error("Failed to rehash the password")
+		return
+	}
+
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	// the password could have been changed while hashing
+	current := um.users[u.ID]
+	if current.PasswordHash != oldHash {
+		return
+	}
+
+	updated := current.Clone()
+	updated.PasswordHash = newHash
+	err = um.replaceUser(updated)
+	if err != nil {
+		logrus.WithError(err).WithField("user_id", u.ID).Error("Failed to save the rehashed password")
+		return
+	}
+
+	logrus.WithField("user_id", u.ID).Info("Rehashed the password with the new cost")
+}
+
+// RegisterUser hashes the password and adds the user
+func (um *UserManager) RegisterUser(u *model.User, password string) error {
+	hash, err := auth.HashPassword(password, um.passwordCost)
+	if err != nil {
+		return err
+	}
+
+	u.PasswordHash = hash
+	return um.AddUser(u)
+}
+
+func (um *UserManager) UpdateProfile(id string, update *model.ProfileUpdate) (*model.User, error) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	u, ok := um.users[id]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("User not found, id: %s", id))
+	}
+
+	// users are shared with the readers, so the change is made on a copy which then replaces the user
+	updated := u.Clone()
+	if update.Email != nil {
+		updated.Email = *update.Email
+	}
+	if update.DisplayName != nil {
+		updated.DisplayName = *update.DisplayName
+	}
+	if update.Addresses != nil {
+		updated.Addresses = update.Addresses
+	}
+
+	err := um.replaceUser(updated)
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func (um *UserManager) ChangePassword(id string, currentPassword string, newPassword string) error {
+	um.mu.RLock()
+	u, ok := um.users[id]
+	um.mu.RUnlock()
+
+	if !ok {
+		return errors.New(fmt.Sprintf("User not found, id: %s", id))
+	}
+
+	if !auth.VerifyPassword(u.PasswordHash, currentPassword) {
+		return ErrWrongPassword
+	}
+
+	hash, err := auth.HashPassword(newPassword, um.passwordCost)
+	if err != nil {
+		return err
+	}
+
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	// the password could have been changed while hashing
+	current := um.users[id]
+	if current.PasswordHash != u.PasswordHash {
+		return ErrWrongPassword
+	}
+
+	updated := current.Clone()
+	updated.PasswordHash = hash
+	return um.replaceUser(updated)
+}
+
+// replaceUser saves the user and swaps it in, must be called with the lock held
+func (um *UserManager) replaceUser(u *model.User) error {
+	err := um.repo.SaveUser(u)
+	if err != nil {
+		return err
+	}
+
+	um.users[u.ID] = u
+	um.usersByName[u.Name] = u
+	return nil
+}
@@ -1,10 +1,23 @@
 package util
 
+// prefixes of the generated ids, orders have none so that their sequence ids are plain numbers
 const (
-	ProductSuffix = "P"
-	UserSuffix    = "U"
+	ProductPrefix  = "P"
+	UserPrefix     = "U"
+	CategoryPrefix = "C"
+	OrderPrefix    = ""
 )
 
+const (
+	RoleAdmin    = "admin"
+	RoleStaff    = "staff" // fulfils orders and manages the catalog
+	RoleCustomer = "customer"
+)
+
+func IsValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleStaff || role == RoleCustomer
+}
+
 type OrderStatus string
 
 const (
@@ -16,7 +29,74 @@ const (
 	OrderStatusError     OrderStatus = "error"
 )
 
+var OrderStatuses = []OrderStatus{
+	OrderStatusPlaced,
+	OrderStatusConfirmed,
+	OrderStatusShipped,
+	OrderStatusCancelled,
+	OrderStatusDelivered,
+	OrderStatusError,
+}
+
+// orderStatusTransitions lists the statuses an order can move to from a given status.
+// an order can only be cancelled before it is shipped, delivered, cancelled and error are terminal
+var orderStatusTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPlaced:    {OrderStatusConfirmed, OrderStatusCancelled, OrderStatusError},
+	OrderStatusConfirmed: {OrderStatusShipped, OrderStatusCancelled, OrderStatusError},
+	OrderStatusShipped:   {OrderStatusDelivered, OrderStatusError},
+	OrderStatusDelivered: {},
+	OrderStatusCancelled: {},
+	OrderStatusError:     {},
+}
+
+// ReleasesStock tells whether moving an order between the statuses puts its units back to the store. The units
+// of a shipped order have left the warehouse, so they stay out when the order fails after that
+func ReleasesStock(from OrderStatus, to OrderStatus) bool {
+	return (to == OrderStatusCancelled || to == OrderStatusError) && from != OrderStatusShipped
+}
+
+func CanTransitionOrderStatus(from OrderStatus, to OrderStatus) bool {
+	for _, s := range orderStatusTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+
+	return false
+}
+
 const (
 	ActionProductIncrease = iota
 	ActionProductDecrease
 )
+
+// reasons recorded in the stock ledger
+const (
+	StockReasonRestock  = "restock"
+	StockReasonSale     = "sale"
+	StockReasonReleased = "order_released"
+	StockReasonImport   = "import" // quantity set by a bulk import, the change can be negative
+)
+
+const (
+	StorageMemory = "memory"
+	StorageSQLite = "sqlite"
+)
+
+// sort orders of a product listing, a leading "-" reverses the order
+const (
+	ProductSortPrice     = "price"
+	ProductSortPriceDesc = "-price"
+	ProductSortName      = "name"
+	ProductSortNameDesc  = "-name"
+	ProductSortNewest    = "newest"
+)
+
+var ProductSorts = []string{ProductSortPrice, ProductSortPriceDesc, ProductSortName, ProductSortNameDesc,
+	ProductSortNewest}
+
+// formats of the bulk product import and export
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json" // JSON lines, one object per line
+)